@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/davidwkirsch/api_spray/internal/config"
+	"github.com/davidwkirsch/api_spray/internal/logging"
+	"github.com/davidwkirsch/api_spray/internal/scanner"
+	"github.com/davidwkirsch/api_spray/internal/targets"
+)
+
+// runCalibrate shows how each target answers for words that don't exist
+func runCalibrate(args []string) {
+	cfg := config.ParseCalibrateFlags(args)
+	if cfg.Format != "terminal" && cfg.Format != "json" {
+		log.Fatalf("Unsupported output format: %s", cfg.Format)
+	}
+
+	logger, err := logging.New(&cfg.Config)
+	if err != nil {
+		log.Fatalf("Failed to create logger: %v", err)
+	}
+
+	lines, err := targets.Load(cfg.TargetsFile, cfg.GetMode(), logger)
+	if err != nil {
+		log.Fatalf("Failed to load targets: %v", err)
+	}
+	targetList, err := targets.NewList(lines)
+	if err != nil {
+		log.Fatalf("Failed to load targets: %v", err)
+	}
+
+	scan, err := scanner.NewScanner(&cfg.Config, logger)
+	if err != nil {
+		log.Fatalf("Failed to create scanner: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	calibrations := scan.Calibrate(ctx, targetList, cfg.Probes)
+
+	if cfg.Format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(calibrations)
+		return
+	}
+
+	wildcards := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tSTATUS\tSIZE\tSTABLE\tWILDCARD\tURL")
+	for _, c := range calibrations {
+		if c.Error != "" {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t%s\n", c.Target, c.Error)
+			continue
+		}
+		if c.Wildcard {
+			wildcards++
+		}
+		url := c.URL
+		if c.Host != "" {
+			url += " (Host: " + c.Host + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%t\t%t\t%s\n", c.Target, c.StatusCode, c.ContentLength, c.Stable, c.Wildcard, url)
+	}
+	tw.Flush()
+
+	fmt.Printf("\n%d of %d targets answer every word with a matching status code\n", wildcards, len(calibrations))
+}
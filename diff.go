@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/davidwkirsch/api_spray/internal/config"
+	"github.com/davidwkirsch/api_spray/internal/diff"
+	"github.com/davidwkirsch/api_spray/internal/output"
+)
+
+// runDiff compares the results of two scans
+func runDiff(args []string) {
+	cfg := config.ParseDiffFlags(args)
+
+	oldResults, err := output.LoadResults(cfg.Old)
+	if err != nil {
+		log.Fatalf("Failed to load results: %v", err)
+	}
+	newResults, err := output.LoadResults(cfg.New)
+	if err != nil {
+		log.Fatalf("Failed to load results: %v", err)
+	}
+
+	d := diff.Compare(oldResults, newResults, cfg.SizeThreshold)
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if cfg.OutputFile != "" {
+		file, err = os.Create(cfg.OutputFile)
+		if err != nil {
+			log.Fatalf("Failed to create diff file: %v", err)
+		}
+		w = file
+	}
+	if err := diff.Write(w, d, cfg.Format); err != nil {
+		log.Fatalf("Failed to write diff: %v", err)
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			log.Fatalf("Failed to write diff: %v", err)
+		}
+	}
+
+	if cfg.ExitCode && !d.Empty() {
+		os.Exit(1)
+	}
+}
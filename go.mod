@@ -1,3 +1,3 @@
 module github.com/davidwkirsch/api_spray
 
-go 1.21
+go 1.24
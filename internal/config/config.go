@@ -2,9 +2,15 @@ package config
 
 import (
 	"bufio"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -12,49 +18,502 @@ import (
 	"github.com/davidwkirsch/api_spray/pkg/types"
 )
 
-// ParseFlags parses command line flags and returns a Config
-func ParseFlags() *types.Config {
+// Defaults returns a Config with the default value of every option
+func Defaults() *types.Config {
+	return &types.Config{
+		Mode:         "wildcards",
+		Threads:      50,
+		Batch:        10,
+		Timeout:      10 * time.Second,
+		OutDir:       "results",
+		MaxRetries:   1,
+		UserAgent:    "Mozilla/5.0 (compatible; api_spray/1.0)",
+		FollowRedirs: true,
+		StatusCodes:  []int{200},
+		ParamsChunk:  40,
+		ParamsIn:     "query",
+		LogFormat:    "text",
+		DeadAfter:    10,
+		DeadRecheck:  time.Minute,
+	}
+}
+
+// ParseScanFlags parses the flags of the scan command
+func ParseScanFlags(args []string) *types.Config {
+	defaults := Defaults()
 	config := &types.Config{}
 
-	// Parse flags
-	flag.StringVar(&config.TargetsFile, "targets", "", "File containing target domains (required)")
-	flag.StringVar(&config.Wordlist, "wordlist", "", "Wordlist file (required)")
-	flag.StringVar(&config.Mode, "mode", "wildcards", "Scan mode: wildcards, directories, subdomains")
-	flag.IntVar(&config.Threads, "threads", 50, "Number of concurrent threads")
-	flag.IntVar(&config.Batch, "batch", 10, "Number of words per batch")
-	flag.DurationVar(&config.Timeout, "timeout", 10*time.Second, "HTTP timeout")
-	flag.StringVar(&config.OutDir, "outdir", "results", "Output directory")
-	flag.BoolVar(&config.DisableHTTP, "disable-http", false, "Disable HTTP fallback")
-	flag.BoolVar(&config.Resume, "resume", false, "Resume previous scan")
-	flag.IntVar(&config.MaxRetries, "retries", 1, "Maximum number of retries per request")
-	flag.StringVar(&config.UserAgent, "user-agent", "Mozilla/5.0 (compatible; api_spray/1.0)", "User agent string")
-	flag.BoolVar(&config.FollowRedirs, "follow-redirects", true, "Follow HTTP redirects")
-
-	var statusCodes string
-	flag.StringVar(&statusCodes, "status-codes", "200", "Comma-separated list of success status codes")
-
-	flag.Parse()
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	fs.StringVar(&config.TargetsFile, "targets", "", "File containing targets, or - for stdin (required)")
+	fs.StringVar(&config.Wordlist, "wordlist", "", "Wordlist file (required)")
+	fs.StringVar(&config.Mode, "mode", defaults.Mode, "Scan mode: wildcards, directories, subdomains, vhosts, params")
+	fs.IntVar(&config.Batch, "batch", defaults.Batch, "Number of words per batch")
+	fs.StringVar(&config.OutDir, "outdir", defaults.OutDir, "Output directory")
+	fs.BoolVar(&config.Resume, "resume", false, "Resume previous scan (see also the resume command)")
+	fs.StringVar(&config.ReplayProxy, "replay-proxy", "", "Proxy URL to re-send saved hits through, e.g. Burp")
+	fs.BoolVar(&config.ResolveIPs, "resolve-ips", false, "Look up hostnames for IP targets via reverse DNS and TLS certificates")
+	fs.BoolVar(&config.StoreResponses, "store-responses", false, "Store the raw response of every saved result in outdir/responses")
+	fs.BoolVar(&config.JSONL, "jsonl", false, "Also write results as JSON lines to outdir/results.jsonl")
+	fs.StringVar(&config.HTMLReport, "html-report", "", "Write an HTML report to this file when the scan finishes")
+	fs.IntVar(&config.ParamsChunk, "params-chunk", defaults.ParamsChunk, "Number of candidate parameters per request (params mode)")
+	fs.StringVar(&config.ParamsIn, "params-in", defaults.ParamsIn, "Where to send parameters in params mode: query, json")
+	fs.BoolVar(&config.Takeover, "takeover", false, "Check subdomains for CNAME-based takeovers (subdomains mode)")
+	fs.BoolVar(&config.Bypass, "bypass", false, "Probe 401 and 403 responses with path encoding, method and header bypasses")
+	addHTTPFlags(fs, config, defaults)
+	addAuthFlags(fs, config)
+	addAuthDiffFlags(fs, config)
+	addPacingFlags(fs, config)
+	addBudgetFlags(fs, config, defaults)
+	addRunFlags(fs, config, defaults)
+
+	statusCodes := fs.String("status-codes", "200", "Comma-separated list of success status codes")
+	fs.Func("ports", "Comma-separated list of ports to expand each target across", func(value string) error {
+		ports, err := parsePorts(value)
+		config.Ports = ports
+		return err
+	})
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s scan -targets <file> -wordlist <file> [options]\n\nSprays the words across every target.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
 
 	// Validate required arguments
 	if config.TargetsFile == "" || config.Wordlist == "" {
-		fmt.Fprintf(os.Stderr, "Usage: %s -targets <file> -wordlist <file> [options]\n", os.Args[0])
-		flag.PrintDefaults()
+		fs.Usage()
 		os.Exit(1)
 	}
 
-	// Parse status codes
-	for _, code := range strings.Split(statusCodes, ",") {
+	config.StatusCodes = parseStatusCodes(*statusCodes, defaults.StatusCodes)
+
+	if config.ParamsChunk < 1 {
+		config.ParamsChunk = 1
+	}
+
+	return config
+}
+
+// addHTTPFlags adds the flags that control how requests are sent
+func addHTTPFlags(fs *flag.FlagSet, config *types.Config, defaults *types.Config) {
+	fs.IntVar(&config.Threads, "threads", defaults.Threads, "Number of concurrent threads")
+	fs.DurationVar(&config.Timeout, "timeout", defaults.Timeout, "HTTP timeout")
+	fs.BoolVar(&config.DisableHTTP, "disable-http", false, "Disable HTTP fallback")
+	fs.IntVar(&config.MaxRetries, "retries", defaults.MaxRetries, "Maximum number of retries per request")
+	fs.StringVar(&config.UserAgent, "user-agent", defaults.UserAgent, "User agent string")
+	fs.StringVar(&config.Rotate, "rotate", "", "Rotate browser-like request profiles per request or per host: request, host")
+	fs.StringVar(&config.UserAgentsFile, "user-agents", "", "File of user agents for -rotate (default: built-in browser list)")
+	fs.DurationVar(&config.HostJitter, "host-jitter", 0, "Space requests to each host by a random delay of up to this duration")
+	fs.BoolVar(&config.FollowRedirs, "follow-redirects", defaults.FollowRedirs, "Follow HTTP redirects")
+	fs.StringVar(&config.Proxy, "proxy", "", "Proxy URL for all requests: http://, https:// or socks5:// (default: HTTP_PROXY env)")
+	fs.BoolVar(&config.TLSVerify, "tls-verify", false, "Verify TLS certificates")
+	fs.StringVar(&config.TLSCAFile, "tls-ca", "", "PEM file with CA certificates to verify against")
+	fs.StringVar(&config.TLSClientCert, "tls-cert", "", "PEM client certificate for mTLS")
+	fs.StringVar(&config.TLSClientKey, "tls-key", "", "PEM client key for mTLS (default: read from -tls-cert)")
+	fs.StringVar(&config.TLSServerName, "sni", "", "Override the TLS server name (SNI)")
+	fs.StringVar(&config.TLSMinVersion, "tls-min-version", "", "Minimum TLS version: 1.0, 1.1, 1.2, 1.3")
+	fs.BoolVar(&config.HTTP2, "http2", false, "Attempt HTTP/2 over TLS, multiplexing requests per host")
+	fs.BoolVar(&config.H2C, "h2c", false, "Use HTTP/2 only, with prior-knowledge h2c for http:// URLs")
+	fs.StringVar(&config.VHostDomain, "domain", "", "Base domain for vhosts mode (Host: word.domain)")
+}
+
+// addAuthFlags adds the flags that set the credentials sent with every request
+func addAuthFlags(fs *flag.FlagSet, config *types.Config) {
+	fs.StringVar(&config.AuthBearer, "auth-bearer", "", "Bearer token sent in the Authorization header")
+	fs.StringVar(&config.AuthBasic, "auth-basic", "", "Basic auth credentials, user:pass")
+	fs.BoolVar(&config.CookieJar, "cookie-jar", false, "Keep cookies set by each host and send them back")
+	fs.StringVar(&config.AuthLoginURL, "auth-login-url", "", "Login URL posted to for a new token when the token expires (needs -auth-check-url)")
+	fs.StringVar(&config.AuthLoginBody, "auth-login-body", "", "Body of the login request (JSON or form encoded)")
+	fs.StringVar(&config.AuthTokenField, "auth-token-field", "", "Dotted path of the token in the login response (default: access_token, token or id_token)")
+	fs.StringVar(&config.AuthRefreshCmd, "auth-refresh-cmd", "", "Shell command printing a new token when the token expires (needs -auth-check-url)")
+	fs.StringVar(&config.AuthCheckURL, "auth-check-url", "", "URL that needs the token; a 401 from it too means the token expired")
+}
+
+// addAuthDiffFlags adds the flags that repeat hits with other credentials
+func addAuthDiffFlags(fs *flag.FlagSet, config *types.Config) {
+	fs.BoolVar(&config.AuthDiff, "auth-diff", false, "Repeat hits without credentials and flag those that return the same content")
+	fs.StringVar(&config.AuthDiffBearer, "auth-diff-bearer", "", "Bearer token of a second role to compare against, instead of no credentials")
+	fs.StringVar(&config.AuthDiffBasic, "auth-diff-basic", "", "Basic auth credentials of a second role to compare against, user:pass")
+}
+
+// addPacingFlags adds the flags that slow the scan down and limit when it runs
+func addPacingFlags(fs *flag.FlagSet, config *types.Config) {
+	fs.DurationVar(&config.Delay, "delay", 0, "Delay between the requests of each thread")
+	fs.DurationVar(&config.Jitter, "jitter", 0, "Random extra delay of up to this duration between the requests of each thread")
+	fs.StringVar(&config.Schedule, "schedule", "", "Only scan during this daily window, e.g. \"22:00-06:00 UTC\", pausing outside it")
+}
+
+// addBudgetFlags adds the flags that stop the scan, or skip a target, once it
+// has used up its time, requests or errors, or stopped answering
+func addBudgetFlags(fs *flag.FlagSet, config *types.Config, defaults *types.Config) {
+	fs.DurationVar(&config.MaxTime, "max-time", 0, "Stop the scan after this long, saving progress for resume, e.g. 2h")
+	fs.Func("max-requests", "Stop the scan after this many requests, saving progress for resume, e.g. 1e6", countFlag(&config.MaxRequests))
+	fs.Func("max-requests-per-host", "Skip the rest of a host's words after this many requests to it", countFlag(&config.MaxRequestsPerHost))
+	fs.Func("max-host-errors", "Skip the rest of a host's words after this many failed requests to it", countFlag(&config.MaxHostErrors))
+	fs.IntVar(&config.DeadAfter, "dead-after", defaults.DeadAfter, "Skip a target's words after this many consecutive timeouts or connection errors, until it answers again (0 to disable)")
+	fs.DurationVar(&config.DeadRecheck, "dead-recheck", defaults.DeadRecheck, "How often to check whether a dead target answers again")
+}
+
+// countFlag parses a non-negative count, also written as e.g. 1e6
+func countFlag(value *int64) func(string) error {
+	return func(s string) error {
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil || n < 0 || n != math.Trunc(n) || n >= math.MaxInt64 {
+			return fmt.Errorf("invalid count %q", s)
+		}
+		*value = int64(n)
+		return nil
+	}
+}
+
+// addRunFlags adds the flags that control logging and monitoring, which can
+// be changed when a scan is resumed
+func addRunFlags(fs *flag.FlagSet, config *types.Config, defaults *types.Config) {
+	fs.BoolVar(&config.Dashboard, "dashboard", false, "Show a live status dashboard (plain status lines when not on a terminal)")
+	fs.StringVar(&config.MetricsAddr, "metrics-addr", "", "Serve Prometheus metrics and a /status endpoint on this address, e.g. :9090")
+	fs.BoolVar(&config.Verbose, "v", false, "Verbose logging, including every failed request")
+	fs.BoolVar(&config.Quiet, "q", false, "Only log warnings and errors")
+	fs.StringVar(&config.LogFormat, "log-format", defaults.LogFormat, "Log format: text, json")
+}
+
+// parseStatusCodes parses a comma-separated list of status codes
+func parseStatusCodes(value string, defaults []int) []int {
+	var codes []int
+	for _, code := range strings.Split(value, ",") {
 		if c, err := strconv.Atoi(strings.TrimSpace(code)); err == nil {
-			config.StatusCodes = append(config.StatusCodes, c)
+			codes = append(codes, c)
 		}
 	}
-	if len(config.StatusCodes) == 0 {
-		config.StatusCodes = []int{200}
+	if len(codes) == 0 {
+		return defaults
+	}
+	return codes
+}
+
+// parsePorts parses a comma-separated list of ports
+func parsePorts(value string) ([]int, error) {
+	var ports []int
+	for _, port := range strings.Split(value, ",") {
+		port = strings.TrimSpace(port)
+		if port == "" {
+			continue
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return nil, fmt.Errorf("invalid port %q", port)
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// ParseResumeFlags parses the flags of the resume command and loads the
+// configuration saved in the output directory it names. Logging and
+// monitoring flags, threads and moved input files can be overridden.
+func ParseResumeFlags(args []string) (*types.Config, error) {
+	defaults := Defaults()
+	overrides := &types.Config{}
+
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	fs.IntVar(&overrides.Threads, "threads", defaults.Threads, "Number of concurrent threads")
+	fs.StringVar(&overrides.TargetsFile, "targets", "", "Targets file, if it moved since the scan started")
+	fs.StringVar(&overrides.Wordlist, "wordlist", "", "Wordlist file, if it moved since the scan started")
+	fs.StringVar(&overrides.Proxy, "proxy", "", "Proxy URL for all requests, if it changed or holds credentials")
+	fs.StringVar(&overrides.ReplayProxy, "replay-proxy", "", "Proxy URL to re-send saved hits through, if it changed or holds credentials")
+	addAuthFlags(fs, overrides)
+	addAuthDiffFlags(fs, overrides)
+	addPacingFlags(fs, overrides)
+	addBudgetFlags(fs, overrides, defaults)
+	addRunFlags(fs, overrides, defaults)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s resume [options] <outdir>\n\nResumes an interrupted scan with the options it was started with.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	config, err := Load(fs.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	config.OutDir = fs.Arg(0)
+	config.Resume = true
+
+	// Flags given on the command line win over the saved configuration
+	passed := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		passed[f.Name] = true
+		switch f.Name {
+		case "threads":
+			config.Threads = overrides.Threads
+		case "targets":
+			config.TargetsFile = overrides.TargetsFile
+		case "wordlist":
+			config.Wordlist = overrides.Wordlist
+		case "proxy":
+			config.Proxy = overrides.Proxy
+		case "replay-proxy":
+			config.ReplayProxy = overrides.ReplayProxy
+		case "dashboard":
+			config.Dashboard = overrides.Dashboard
+		case "metrics-addr":
+			config.MetricsAddr = overrides.MetricsAddr
+		case "v":
+			config.Verbose = overrides.Verbose
+		case "q":
+			config.Quiet = overrides.Quiet
+		case "log-format":
+			config.LogFormat = overrides.LogFormat
+		case "auth-bearer":
+			config.AuthBearer = overrides.AuthBearer
+		case "auth-basic":
+			config.AuthBasic = overrides.AuthBasic
+		case "cookie-jar":
+			config.CookieJar = overrides.CookieJar
+		case "auth-login-url":
+			config.AuthLoginURL = overrides.AuthLoginURL
+		case "auth-login-body":
+			config.AuthLoginBody = overrides.AuthLoginBody
+		case "auth-token-field":
+			config.AuthTokenField = overrides.AuthTokenField
+		case "auth-refresh-cmd":
+			config.AuthRefreshCmd = overrides.AuthRefreshCmd
+		case "auth-check-url":
+			config.AuthCheckURL = overrides.AuthCheckURL
+		case "delay":
+			config.Delay = overrides.Delay
+		case "jitter":
+			config.Jitter = overrides.Jitter
+		case "schedule":
+			config.Schedule = overrides.Schedule
+		case "max-time":
+			config.MaxTime = overrides.MaxTime
+		case "max-requests":
+			config.MaxRequests = overrides.MaxRequests
+		case "max-requests-per-host":
+			config.MaxRequestsPerHost = overrides.MaxRequestsPerHost
+		case "max-host-errors":
+			config.MaxHostErrors = overrides.MaxHostErrors
+		case "dead-after":
+			config.DeadAfter = overrides.DeadAfter
+		case "dead-recheck":
+			config.DeadRecheck = overrides.DeadRecheck
+		case "auth-diff":
+			config.AuthDiff = overrides.AuthDiff
+		case "auth-diff-bearer":
+			config.AuthDiffBearer = overrides.AuthDiffBearer
+		case "auth-diff-basic":
+			config.AuthDiffBasic = overrides.AuthDiffBasic
+		}
+	})
+
+	if config.TargetsFile == "-" {
+		return nil, fmt.Errorf("targets were read from stdin; pass them again with -targets <file>")
+	}
+
+	// Credentials are not saved; resuming without them would quietly scan
+	// as an anonymous user
+	var missing []string
+	for _, name := range config.OmittedAuth {
+		if !passed[name] {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("credentials are not saved; pass %s again (an empty value resumes without it)",
+			strings.Join(missing, ", "))
+	}
+
+	return config, nil
+}
+
+// ParseMergeFlags parses the flags of the merge command
+func ParseMergeFlags(args []string) *types.MergeConfig {
+	config := &types.MergeConfig{}
+
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	fs.StringVar(&config.OutDir, "o", "", "Output directory to merge into (required)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s merge -o <outdir> <outdir> <outdir>...\n\nCombines the results of several scans into one output directory.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+	config.Inputs = fs.Args()
+	if config.OutDir == "" || len(config.Inputs) == 0 {
+		fs.Usage()
+		os.Exit(1)
 	}
 
 	return config
 }
 
+// ParseDiffFlags parses the flags of the diff command
+func ParseDiffFlags(args []string) *types.DiffConfig {
+	config := &types.DiffConfig{}
+
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.StringVar(&config.Format, "format", "text", "Output format: text, json or markdown")
+	fs.StringVar(&config.OutputFile, "o", "", "Write the diff to this file instead of stdout")
+	fs.Int64Var(&config.SizeThreshold, "size-threshold", 0, "Ignore size changes of up to this many bytes")
+	fs.BoolVar(&config.ExitCode, "exit-code", false, "Exit with status 1 when the scans differ")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s diff [options] <old> <new>\n\nCompares two result sets: output directories, results.csv or results.jsonl files.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	config.Old = fs.Arg(0)
+	config.New = fs.Arg(1)
+
+	return config
+}
+
+// ParseCalibrateFlags parses the flags of the calibrate command
+func ParseCalibrateFlags(args []string) *types.CalibrateConfig {
+	defaults := Defaults()
+	config := &types.CalibrateConfig{Config: *defaults}
+
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	fs.StringVar(&config.TargetsFile, "targets", "", "File containing targets, or - for stdin (required)")
+	fs.StringVar(&config.Mode, "mode", defaults.Mode, "Scan mode: wildcards, directories, subdomains, vhosts")
+	fs.StringVar(&config.Format, "format", "terminal", "Output format: terminal, json")
+	fs.IntVar(&config.Probes, "probes", 2, "Number of random words to request per target")
+	addHTTPFlags(fs, &config.Config, defaults)
+	addAuthFlags(fs, &config.Config)
+	fs.BoolVar(&config.Verbose, "v", false, "Verbose logging, including every failed request")
+	fs.BoolVar(&config.Quiet, "q", false, "Only log warnings and errors")
+
+	statusCodes := fs.String("status-codes", "200", "Comma-separated list of success status codes")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s calibrate -targets <file> [options]\n\nRequests random words from each target to show how it answers for paths,\nsubdomains or virtual hosts that don't exist, without running a scan.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+	if config.TargetsFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	config.StatusCodes = parseStatusCodes(*statusCodes, defaults.StatusCodes)
+	if config.Probes < 1 {
+		config.Probes = 1
+	}
+
+	return config
+}
+
+// Save writes the configuration to config.json in its output directory. Input
+// files are saved with absolute paths so the scan can be resumed from anywhere.
+func Save(config *types.Config) error {
+	saved := *config
+	if saved.TargetsFile != "-" {
+		if path, err := filepath.Abs(saved.TargetsFile); err == nil {
+			saved.TargetsFile = path
+		}
+	}
+	if path, err := filepath.Abs(saved.Wordlist); err == nil {
+		saved.Wordlist = path
+	}
+
+	saved.OmittedAuth = omittedAuth(config)
+	if hasUserinfo(saved.Proxy) {
+		saved.Proxy = ""
+	}
+	if hasUserinfo(saved.ReplayProxy) {
+		saved.ReplayProxy = ""
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	return os.WriteFile(fmt.Sprintf("%s/config.json", config.OutDir), data, 0644)
+}
+
+// omittedAuth returns the credential flags that are set but not saved. The
+// refresh command often embeds a secret, and proxies are left out only when
+// their URL holds a user and password.
+func omittedAuth(config *types.Config) []string {
+	var names []string
+	for _, cred := range []struct {
+		name  string
+		value string
+	}{
+		{"auth-bearer", config.AuthBearer},
+		{"auth-basic", config.AuthBasic},
+		{"auth-login-body", config.AuthLoginBody},
+		{"auth-refresh-cmd", config.AuthRefreshCmd},
+		{"auth-diff-bearer", config.AuthDiffBearer},
+		{"auth-diff-basic", config.AuthDiffBasic},
+	} {
+		if cred.value != "" {
+			names = append(names, cred.name)
+		}
+	}
+	if hasUserinfo(config.Proxy) {
+		names = append(names, "proxy")
+	}
+	if hasUserinfo(config.ReplayProxy) {
+		names = append(names, "replay-proxy")
+	}
+	return names
+}
+
+// hasUserinfo reports whether a proxy URL holds credentials
+func hasUserinfo(proxy string) bool {
+	proxyURL, err := url.Parse(proxy)
+	return err == nil && proxyURL.User != nil
+}
+
+// Load reads the configuration saved in an output directory
+func Load(outDir string) (*types.Config, error) {
+	data, err := os.ReadFile(fmt.Sprintf("%s/config.json", outDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no saved configuration in %s", outDir)
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config := Defaults()
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return config, nil
+}
+
+// ParseReportFlags parses the flags of the report command
+func ParseReportFlags(args []string) *types.ReportConfig {
+	config := &types.ReportConfig{}
+
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	fs.StringVar(&config.OutDir, "outdir", "results", "Output directory of the scan to report on")
+	fs.StringVar(&config.Format, "format", "terminal", "Report format: terminal, markdown, html")
+	fs.StringVar(&config.Output, "o", "", "Write the report to this file instead of stdout")
+	fs.Int64Var(&config.SizeBucket, "size-bucket", 100, "Width in bytes of the fixed size buckets responses are clustered by (0-99, 100-199, ... for 100)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s report [options]\n\nClusters the results of a scan into unique findings.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+
+	return config
+}
+
 // LoadLines loads lines from a file, filtering out empty lines and comments
 func LoadLines(filename string) ([]string, error) {
 	file, err := os.Open(filename)
@@ -74,3 +533,62 @@ func LoadLines(filename string) ([]string, error) {
 
 	return lines, scanner.Err()
 }
+
+// LoadResultURLs loads the URLs of responses saved in a previous scan's results.csv,
+// skipping errors and duplicates
+func LoadResultURLs(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // Allow variable number of fields
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	urlCol, statusCol := -1, -1
+	for i, name := range header {
+		switch name {
+		case "url":
+			urlCol = i
+		case "status_code":
+			statusCol = i
+		}
+	}
+	if urlCol < 0 {
+		return nil, fmt.Errorf("no url column in %s", filename)
+	}
+
+	seen := make(map[string]bool)
+	var urls []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		if len(record) <= urlCol {
+			continue
+		}
+		if statusCol >= 0 && len(record) > statusCol {
+			if code, err := strconv.Atoi(record[statusCol]); err != nil || code == 0 {
+				continue
+			}
+		}
+
+		url := record[urlCol]
+		if url != "" && !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,284 @@
+package dashboard
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+const (
+	// refreshInterval is how often the terminal dashboard is redrawn
+	refreshInterval = 500 * time.Millisecond
+	// logInterval is how often a status line is printed when not on a terminal
+	logInterval = 10 * time.Second
+	// topHosts and latestHits bound what the dashboard lists
+	topHosts   = 3
+	latestHits = 5
+)
+
+// Counters are the scan counters the dashboard displays
+type Counters struct {
+	Total     int64
+	Success   int64
+	Errors    int64
+	Timeouts  int64
+	Filtered  int64
+	Completed int64
+	TotalWork int64
+}
+
+// Dashboard shows live scan progress. On a terminal it keeps a status block at
+// the bottom of the screen, with output written through Writer scrolling above
+// it; otherwise it prints a plain status line periodically.
+type Dashboard struct {
+	counters func() Counters
+	out      io.Writer
+	terminal bool
+
+	mutex      sync.Mutex
+	hostCounts map[string]int
+	hits       []string
+	started    time.Time
+	lastTotal  int64
+	lastTick   time.Time
+	rate       float64
+	drawn      int
+	stopped    bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a dashboard reading its numbers from counters and drawing to out
+func New(counters func() Counters, out io.Writer) *Dashboard {
+	return &Dashboard{
+		counters:   counters,
+		out:        out,
+		terminal:   isTerminal(out),
+		hostCounts: make(map[string]int),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start begins updating the dashboard until Stop is called
+func (d *Dashboard) Start() {
+	d.started = time.Now()
+	d.lastTick = d.started
+
+	d.wg.Add(1)
+	go d.loop()
+}
+
+// Stop stops updating and clears the status block
+func (d *Dashboard) Stop() {
+	close(d.done)
+	d.wg.Wait()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.terminal {
+		d.clear()
+	}
+	d.stopped = true
+}
+
+// Terminal reports whether the dashboard draws a status block on a terminal
+func (d *Dashboard) Terminal() bool {
+	return d.terminal
+}
+
+// Writer returns a writer for whole lines, such as log events, that are
+// written above the status block instead of through it
+func (d *Dashboard) Writer() io.Writer {
+	return lineWriter{d}
+}
+
+// lineWriter writes lines to the dashboard's output above the status block
+type lineWriter struct {
+	d *Dashboard
+}
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	d := w.d
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.terminal || d.stopped {
+		return d.out.Write(p)
+	}
+	d.clear()
+	n, err := d.out.Write(p)
+	d.draw()
+	return n, err
+}
+
+// RecordResult counts a response for its host and remembers saved hits
+func (d *Dashboard) RecordResult(result types.Result, saved bool) {
+	if result.StatusCode == 0 {
+		return
+	}
+
+	host := result.Host
+	if host == "" {
+		host = hostOf(result.URL)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.hostCounts[host]++
+	if saved {
+		hit := fmt.Sprintf("[%d] %s", result.StatusCode, result.URL)
+		if result.Host != "" {
+			hit += " (Host: " + result.Host + ")"
+		}
+		d.hits = append(d.hits, hit)
+		if len(d.hits) > latestHits {
+			d.hits = d.hits[1:]
+		}
+	}
+}
+
+// loop refreshes the dashboard until stopped
+func (d *Dashboard) loop() {
+	defer d.wg.Done()
+
+	interval := logInterval
+	if d.terminal {
+		interval = refreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.mutex.Lock()
+			if d.terminal {
+				d.clear()
+				d.draw()
+			} else {
+				fmt.Fprintf(d.out, "   %s\n", d.statusLine())
+			}
+			d.mutex.Unlock()
+		}
+	}
+}
+
+// clear erases the status block from the terminal
+func (d *Dashboard) clear() {
+	if d.drawn > 0 {
+		fmt.Fprintf(d.out, "\033[%dF\033[J", d.drawn)
+		d.drawn = 0
+	}
+}
+
+// draw writes the status block below the cursor
+func (d *Dashboard) draw() {
+	lines := []string{"── " + d.statusLine()}
+
+	if hosts := d.topHosts(); hosts != "" {
+		lines = append(lines, "   Top hosts: "+hosts)
+	}
+	for _, hit := range d.hits {
+		lines = append(lines, "   Hit: "+hit)
+	}
+
+	for _, line := range lines {
+		fmt.Fprintf(d.out, "\033[K%s\n", line)
+	}
+	d.drawn = len(lines)
+}
+
+// statusLine summarizes rate, progress, ETA and error rates
+func (d *Dashboard) statusLine() string {
+	c := d.counters()
+	now := time.Now()
+
+	// Smooth the rate so a single slow tick doesn't swing the ETA
+	if elapsed := now.Sub(d.lastTick).Seconds(); elapsed >= 1 {
+		current := float64(c.Total-d.lastTotal) / elapsed
+		if d.rate == 0 {
+			d.rate = current
+		} else {
+			d.rate = 0.7*d.rate + 0.3*current
+		}
+		d.lastTotal = c.Total
+		d.lastTick = now
+	}
+
+	percent := 0.0
+	if c.TotalWork > 0 {
+		percent = float64(c.Completed) / float64(c.TotalWork) * 100
+	}
+
+	eta := "-"
+	if remaining := c.TotalWork - c.Completed; remaining > 0 && d.rate > 0 {
+		eta = (time.Duration(float64(remaining)/d.rate) * time.Second).Round(time.Second).String()
+	}
+
+	errorRate, timeoutRate := 0.0, 0.0
+	if c.Total > 0 {
+		errorRate = float64(c.Errors) / float64(c.Total) * 100
+		timeoutRate = float64(c.Timeouts) / float64(c.Total) * 100
+	}
+
+	return fmt.Sprintf("%d/%d (%.1f%%) | %.0f req/s | ETA %s | %d hits | errors %.1f%% | timeouts %.1f%% | %d filtered | %s elapsed",
+		c.Completed, c.TotalWork, percent,
+		d.rate, eta, c.Success,
+		errorRate, timeoutRate, c.Filtered,
+		time.Since(d.started).Round(time.Second))
+}
+
+// topHosts lists the hosts with the most responses
+func (d *Dashboard) topHosts() string {
+	type hostCount struct {
+		host  string
+		count int
+	}
+
+	counts := make([]hostCount, 0, len(d.hostCounts))
+	for host, count := range d.hostCounts {
+		counts = append(counts, hostCount{host, count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].host < counts[j].host
+	})
+
+	var parts []string
+	for i := 0; i < len(counts) && i < topHosts; i++ {
+		parts = append(parts, fmt.Sprintf("%s (%d)", counts[i].host, counts[i].count))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// hostOf returns the host[:port] of a URL
+func hostOf(url string) string {
+	host := strings.TrimPrefix(url, "http://")
+	host = strings.TrimPrefix(host, "https://")
+	return strings.Split(host, "/")[0]
+}
+
+// isTerminal reports whether w is an interactive terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,246 @@
+package diff
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// Output formats
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+// Endpoint is a result present in only one of the scans
+type Endpoint struct {
+	Target        string `json:"target"`
+	Word          string `json:"word"`
+	Method        string `json:"method"`
+	URL           string `json:"url"`
+	StatusCode    int    `json:"status_code"`
+	ContentLength int64  `json:"content_length"`
+	Title         string `json:"title,omitempty"`
+}
+
+// Change is an endpoint found in both scans whose response differs
+type Change struct {
+	Target string   `json:"target"`
+	Word   string   `json:"word"`
+	Method string   `json:"method"`
+	URL    string   `json:"url"`
+	Old    Endpoint `json:"old"`
+	New    Endpoint `json:"new"`
+	// Fields lists what changed: status, size and title
+	Fields []string `json:"fields"`
+}
+
+// Diff holds the differences between an old and a new scan
+type Diff struct {
+	New         []Endpoint `json:"new"`
+	Disappeared []Endpoint `json:"disappeared"`
+	Changed     []Change   `json:"changed"`
+	Unchanged   int        `json:"unchanged"`
+}
+
+// Empty reports whether the scans found the same endpoints with the same
+// responses
+func (d *Diff) Empty() bool {
+	return len(d.New) == 0 && len(d.Disappeared) == 0 && len(d.Changed) == 0
+}
+
+// Compare matches the results of two scans by target, word and method.
+// Sizes that differ by no more than sizeThreshold bytes count as unchanged.
+// Failed requests are ignored.
+func Compare(old, new []types.Result, sizeThreshold int64) *Diff {
+	oldEndpoints := index(old)
+	newEndpoints := index(new)
+	d := &Diff{New: []Endpoint{}, Disappeared: []Endpoint{}, Changed: []Change{}}
+
+	for key, after := range newEndpoints {
+		before, ok := oldEndpoints[key]
+		if !ok {
+			d.New = append(d.New, after)
+			continue
+		}
+
+		var fields []string
+		if before.StatusCode != after.StatusCode {
+			fields = append(fields, "status")
+		}
+		if abs(before.ContentLength-after.ContentLength) > sizeThreshold {
+			fields = append(fields, "size")
+		}
+		if before.Title != after.Title {
+			fields = append(fields, "title")
+		}
+		if len(fields) == 0 {
+			d.Unchanged++
+			continue
+		}
+		d.Changed = append(d.Changed, Change{
+			Target: after.Target,
+			Word:   after.Word,
+			Method: after.Method,
+			URL:    after.URL,
+			Old:    before,
+			New:    after,
+			Fields: fields,
+		})
+	}
+	for key, before := range oldEndpoints {
+		if _, ok := newEndpoints[key]; !ok {
+			d.Disappeared = append(d.Disappeared, before)
+		}
+	}
+
+	slices.SortFunc(d.New, compareEndpoints)
+	slices.SortFunc(d.Disappeared, compareEndpoints)
+	slices.SortFunc(d.Changed, func(a, b Change) int {
+		return compareEndpoints(a.New, b.New)
+	})
+	return d
+}
+
+// index maps the successful results of a scan by endpoint
+func index(results []types.Result) map[string]Endpoint {
+	endpoints := make(map[string]Endpoint)
+	for _, result := range results {
+		if result.StatusCode == 0 || result.Error != "" {
+			continue
+		}
+
+		// Results written before methods were recorded are GET requests
+		method := result.Method
+		if method == "" {
+			method = "GET"
+		}
+		endpoints[strings.Join([]string{result.Target, result.Word, method}, "|")] = Endpoint{
+			Target:        result.Target,
+			Word:          result.Word,
+			Method:        method,
+			URL:           result.URL,
+			StatusCode:    result.StatusCode,
+			ContentLength: result.ContentLength,
+			Title:         result.Title,
+		}
+	}
+	return endpoints
+}
+
+// compareEndpoints orders endpoints by target, word and method
+func compareEndpoints(a, b Endpoint) int {
+	return cmp.Or(
+		cmp.Compare(a.Target, b.Target),
+		cmp.Compare(a.Word, b.Word),
+		cmp.Compare(a.Method, b.Method),
+	)
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Write writes the diff to w in the given format
+func Write(w io.Writer, d *Diff, format string) error {
+	switch format {
+	case FormatText:
+		return writeText(w, d)
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(d)
+	case FormatMarkdown:
+		return writeMarkdown(w, d)
+	default:
+		return fmt.Errorf("unknown diff format %q", format)
+	}
+}
+
+// writeText writes the diff as aligned tables for the terminal
+func writeText(w io.Writer, d *Diff) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "%d new, %d disappeared, %d changed, %d unchanged\n",
+		len(d.New), len(d.Disappeared), len(d.Changed), d.Unchanged)
+
+	writeEndpoints := func(heading string, sign string, endpoints []Endpoint) {
+		if len(endpoints) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "\n%s:\n", heading)
+		for _, e := range endpoints {
+			fmt.Fprintf(tw, "%s %s\t%s\t%d\t%d\t%s\n", sign, e.Method, e.URL, e.StatusCode, e.ContentLength, e.Title)
+		}
+	}
+	writeEndpoints("New", "+", d.New)
+	writeEndpoints("Disappeared", "-", d.Disappeared)
+
+	if len(d.Changed) > 0 {
+		fmt.Fprintf(tw, "\nChanged:\n")
+		for _, c := range d.Changed {
+			fmt.Fprintf(tw, "~ %s\t%s\t%s\n", c.Method, c.URL, describeChange(c))
+		}
+	}
+
+	return tw.Flush()
+}
+
+// writeMarkdown writes the diff as Markdown tables, for tickets and chat alerts
+func writeMarkdown(w io.Writer, d *Diff) error {
+	fmt.Fprintf(w, "**%d new, %d disappeared, %d changed, %d unchanged**\n",
+		len(d.New), len(d.Disappeared), len(d.Changed), d.Unchanged)
+
+	writeEndpoints := func(heading string, endpoints []Endpoint) {
+		if len(endpoints) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n### %s\n\n| Method | URL | Status | Size | Title |\n|---|---|---|---|---|\n", heading)
+		for _, e := range endpoints {
+			fmt.Fprintf(w, "| %s | %s | %d | %d | %s |\n", e.Method, escapeCell(e.URL), e.StatusCode, e.ContentLength, escapeCell(e.Title))
+		}
+	}
+	writeEndpoints("New", d.New)
+	writeEndpoints("Disappeared", d.Disappeared)
+
+	if len(d.Changed) > 0 {
+		fmt.Fprintf(w, "\n### Changed\n\n| Method | URL | Change |\n|---|---|---|\n")
+		for _, c := range d.Changed {
+			fmt.Fprintf(w, "| %s | %s | %s |\n", c.Method, escapeCell(c.URL), escapeCell(describeChange(c)))
+		}
+	}
+
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// describeChange summarizes the changed fields as old -> new
+func describeChange(c Change) string {
+	var parts []string
+	for _, field := range c.Fields {
+		switch field {
+		case "status":
+			parts = append(parts, fmt.Sprintf("status %d -> %d", c.Old.StatusCode, c.New.StatusCode))
+		case "size":
+			parts = append(parts, fmt.Sprintf("size %d -> %d", c.Old.ContentLength, c.New.ContentLength))
+		case "title":
+			parts = append(parts, fmt.Sprintf("title %q -> %q", c.Old.Title, c.New.Title))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// escapeCell keeps a value from breaking a Markdown table row
+func escapeCell(value string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(value)
+}
@@ -0,0 +1,304 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// minRefreshInterval keeps endpoints that always answer 401 from triggering a
+// token refresh on every request
+const minRefreshInterval = 10 * time.Second
+
+// maxWorkedURLs bounds how many URLs are remembered as accepting the token
+const maxWorkedURLs = 10000
+
+// TokenRefresher fetches a new bearer token once requests start failing with
+// 401. An empty token with a nil error means the refresh renewed session
+// cookies instead.
+type TokenRefresher interface {
+	Refresh(ctx context.Context) (string, error)
+}
+
+// CommandRefresher runs a shell command and uses its trimmed output as the token
+type CommandRefresher struct {
+	Command string
+}
+
+// Refresh runs the command
+func (r CommandRefresher) Refresh(ctx context.Context) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", r.Command)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("token command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	token := strings.TrimSpace(string(output))
+	if token == "" {
+		return "", fmt.Errorf("token command printed no token")
+	}
+	return token, nil
+}
+
+// LoginRefresher posts a login request and reads the token from the JSON
+// response. When the response holds no token but sets cookies, the refresh
+// succeeds with the cookies kept in the client's cookie jar.
+type LoginRefresher struct {
+	URL  string
+	Body string
+	// TokenField is the dotted path of the token in the response, e.g.
+	// data.token; by default access_token, token or id_token
+	TokenField string
+
+	client    *http.Client
+	userAgent string
+}
+
+// Refresh sends the login request
+func (r *LoginRefresher) Refresh(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", r.URL, strings.NewReader(r.Body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", r.userAgent)
+	if strings.HasPrefix(strings.TrimSpace(r.Body), "{") {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("login request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("login request returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read login response: %w", err)
+	}
+
+	fields := []string{"access_token", "token", "id_token"}
+	if r.TokenField != "" {
+		fields = []string{r.TokenField}
+	}
+	var data any
+	if json.Unmarshal(body, &data) == nil {
+		for _, field := range fields {
+			if token := lookupField(data, field); token != "" {
+				return token, nil
+			}
+		}
+	}
+
+	if len(resp.Cookies()) > 0 && r.client.Jar != nil {
+		return "", nil
+	}
+	return "", fmt.Errorf("no %s in login response", strings.Join(fields, " or "))
+}
+
+// lookupField returns the string at a dotted path in decoded JSON
+func lookupField(data any, path string) string {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := data.(map[string]any)
+		if !ok {
+			return ""
+		}
+		data = object[key]
+	}
+	value, _ := data.(string)
+	return value
+}
+
+// auth holds the credentials sent with every request
+type auth struct {
+	basicUser string
+	basicPass string
+	basic     bool
+
+	mutex     sync.Mutex
+	token     string
+	refresher TokenRefresher
+
+	// refreshMutex runs one refresh at a time without holding up requests
+	// that only read the token
+	refreshMutex sync.Mutex
+	lastRefresh  time.Time
+
+	// A 401 only means the token expired for a URL that answered with it
+	// before, or when the -auth-check-url gets a 401 too
+	worked   map[string]bool
+	checkURL string
+
+	// checkMutex makes 401s that arrive during a check wait for its answer
+	checkMutex   sync.Mutex
+	lastCheck    time.Time
+	expiredToken string // the token the last check found expired
+	expired      bool
+}
+
+// newAuth builds the credentials from the -auth-* options, with the login
+// request sent through client
+func newAuth(config *types.Config, client *http.Client) (*auth, error) {
+	a := &auth{
+		token:    config.AuthBearer,
+		worked:   make(map[string]bool),
+		checkURL: config.AuthCheckURL,
+	}
+
+	if config.AuthBasic != "" {
+		user, pass, ok := strings.Cut(config.AuthBasic, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid -auth-basic %q (use user:pass)", config.AuthBasic)
+		}
+		a.basicUser, a.basicPass, a.basic = user, pass, true
+	}
+
+	switch {
+	case config.AuthLoginURL != "" && config.AuthRefreshCmd != "":
+		return nil, fmt.Errorf("-auth-login-url and -auth-refresh-cmd can't be combined")
+	case config.AuthLoginURL != "":
+		a.refresher = &LoginRefresher{
+			URL:        config.AuthLoginURL,
+			Body:       config.AuthLoginBody,
+			TokenField: config.AuthTokenField,
+			client:     client,
+			userAgent:  config.UserAgent,
+		}
+	case config.AuthRefreshCmd != "":
+		a.refresher = CommandRefresher{Command: config.AuthRefreshCmd}
+	}
+	if a.refresher != nil && a.checkURL == "" {
+		// Scans request most URLs once, so without it no 401 ever counts as
+		// an expired token and the refresher never runs
+		return nil, fmt.Errorf("-auth-login-url and -auth-refresh-cmd need -auth-check-url")
+	}
+
+	return a, nil
+}
+
+// apply adds the credentials to a request and returns the token it used
+func (a *auth) apply(req *http.Request) string {
+	a.mutex.Lock()
+	token := a.token
+	a.mutex.Unlock()
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if a.basic {
+		req.SetBasicAuth(a.basicUser, a.basicPass)
+	}
+	return token
+}
+
+// succeeded remembers that url answered a request sent with token
+func (a *auth) succeeded(url, token string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.refresher != nil && a.token == token && len(a.worked) < maxWorkedURLs {
+		a.worked[url] = true
+	}
+}
+
+// tokenExpired reports whether a 401 for url, sent with token, means the
+// token expired rather than that url needs other credentials: the token was
+// already refreshed, url accepted it before, or the -auth-check-url now gets
+// a 401 as well. The check URL is requested at most every minRefreshInterval;
+// in between, the last check's answer holds.
+func (hc *Client) tokenExpired(ctx context.Context, url, token string) bool {
+	a := hc.auth
+	a.mutex.Lock()
+	if a.refresher == nil {
+		a.mutex.Unlock()
+		return false
+	}
+	if a.token != token || a.worked[url] {
+		a.mutex.Unlock()
+		return true
+	}
+	checkURL := a.checkURL
+	a.mutex.Unlock()
+
+	if checkURL == "" {
+		return false
+	}
+
+	a.checkMutex.Lock()
+	defer a.checkMutex.Unlock()
+	if time.Since(a.lastCheck) < minRefreshInterval {
+		return a.expired && a.expiredToken == token
+	}
+
+	a.lastCheck = time.Now()
+	a.expired = false
+	resp, _, err := hc.do(ctx, checkURL, RequestOptions{})
+	if err != nil {
+		hc.logger.Debug("Token check failed", "url", checkURL, "error", err)
+		return false
+	}
+	resp.Body.Close()
+	a.expired, a.expiredToken = resp.StatusCode == http.StatusUnauthorized, token
+	return a.expired
+}
+
+// refresh renews the token after a request sent with token got a 401, and
+// reports whether the request should be retried. Concurrent callers wait for
+// a single refresh and then retry with its token.
+func (a *auth) refresh(ctx context.Context, token string, logger *slog.Logger) bool {
+	a.refreshMutex.Lock()
+	defer a.refreshMutex.Unlock()
+
+	a.mutex.Lock()
+	refresher, current := a.refresher, a.token
+	a.mutex.Unlock()
+
+	if refresher == nil {
+		return false
+	}
+	if current != token {
+		// Refreshed while this request was in flight
+		return true
+	}
+	if time.Since(a.lastRefresh) < minRefreshInterval {
+		return false
+	}
+
+	a.lastRefresh = time.Now()
+	newToken, err := refresher.Refresh(ctx)
+	if err != nil {
+		logger.Warn("Failed to refresh token", "error", err)
+		return false
+	}
+
+	a.mutex.Lock()
+	a.token = newToken
+	a.worked = make(map[string]bool)
+	a.mutex.Unlock()
+	logger.Info("Refreshed token")
+	return true
+}
+
+// SetTokenRefresher replaces the refresher run when requests get a 401 and
+// the -auth-check-url gets one too
+func (hc *Client) SetTokenRefresher(refresher TokenRefresher) {
+	hc.auth.mutex.Lock()
+	defer hc.auth.mutex.Unlock()
+	hc.auth.refresher = refresher
+}
@@ -0,0 +1,134 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// BypassVariant is a request that may reach a protected path another way
+type BypassVariant struct {
+	Technique string
+	URL       string
+	Method    string
+	Headers   map[string]string
+	// Rewrite is set when the request goes to the root and a header names the
+	// path, so the root's own response must be ruled out
+	Rewrite bool
+}
+
+// BypassVariants returns the path encoding, method override and header
+// variants of a URL
+func BypassVariants(rawURL string) []BypassVariant {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+
+	base := u.Scheme + "://" + u.Host
+	query := ""
+	if u.RawQuery != "" {
+		query = "?" + u.RawQuery
+	}
+
+	path := strings.TrimSuffix(u.EscapedPath(), "/")
+	variants := []BypassVariant{
+		{Technique: "method POST", URL: rawURL, Method: "POST"},
+		{Technique: "method override", URL: rawURL, Method: "POST", Headers: map[string]string{"X-HTTP-Method-Override": "GET"}},
+		{Technique: "X-Forwarded-For", URL: rawURL, Headers: map[string]string{"X-Forwarded-For": "127.0.0.1"}},
+		{Technique: "X-Real-IP", URL: rawURL, Headers: map[string]string{"X-Real-IP": "127.0.0.1"}},
+	}
+	if path == "" {
+		// The root has no path to encode or rewrite to
+		return variants
+	}
+
+	slash := strings.LastIndex(path, "/")
+	parent, last := path[:slash+1], path[slash+1:]
+	variants = append(variants,
+		BypassVariant{Technique: "%2e", URL: base + parent + "%2e/" + last + query},
+		BypassVariant{Technique: "//", URL: base + "/" + path + query},
+		BypassVariant{Technique: ";/", URL: base + parent + ";/" + last + query},
+		BypassVariant{Technique: "trailing dot", URL: base + path + "/." + query},
+		BypassVariant{Technique: "X-Original-URL", URL: base + "/", Headers: map[string]string{"X-Original-URL": path + query}, Rewrite: true},
+		BypassVariant{Technique: "X-Rewrite-URL", URL: base + "/", Headers: map[string]string{"X-Rewrite-URL": path + query}, Rewrite: true},
+	)
+	return variants
+}
+
+// TestBypass sends the bypass variants of a 401 or 403 response and returns
+// those that got a 2xx instead
+func TestBypass(ctx context.Context, httpClient *Client, candidate types.BypassCandidate) []types.BypassResult {
+	var results []types.BypassResult
+	var rootStatus int
+	var rootLength int64 = -1
+
+	for _, variant := range BypassVariants(candidate.URL) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		status, length, err := bypassRequest(ctx, httpClient, variant.URL, RequestOptions{Method: variant.Method, Host: candidate.Host, Headers: variant.Headers})
+		if err != nil || status < 200 || status > 299 || status == candidate.StatusCode {
+			continue
+		}
+
+		if variant.Rewrite {
+			// The root answering by itself isn't a bypass
+			if rootLength == -1 {
+				rootStatus, rootLength, err = bypassRequest(ctx, httpClient, variant.URL, RequestOptions{Host: candidate.Host})
+				if err != nil {
+					continue
+				}
+			}
+			if status == rootStatus && length == rootLength {
+				continue
+			}
+		}
+
+		method := variant.Method
+		if method == "" {
+			method = "GET"
+		}
+		results = append(results, types.BypassResult{
+			BypassCandidate: candidate,
+			Technique:       variant.Technique,
+			Method:          method,
+			BypassURL:       variant.URL,
+			Header:          formatHeaders(variant.Headers),
+			BypassStatus:    status,
+			BypassLength:    length,
+		})
+	}
+
+	return results
+}
+
+// bypassRequest sends a single request and returns its status code and body size
+func bypassRequest(ctx context.Context, httpClient *Client, url string, opts RequestOptions) (int, int64, error) {
+	resp, err := httpClient.Do(ctx, url, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	length, err := io.Copy(io.Discard, io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return 0, 0, err
+	}
+	return resp.StatusCode, length, nil
+}
+
+// formatHeaders formats headers as "Name: value" pairs separated by "; "
+func formatHeaders(headers map[string]string) string {
+	var pairs []string
+	for name, value := range headers {
+		pairs = append(pairs, name+": "+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "; ")
+}
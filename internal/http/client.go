@@ -1,13 +1,23 @@
 package http
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/davidwkirsch/api_spray/pkg/types"
@@ -18,18 +28,93 @@ type Client struct {
 	client    *http.Client
 	userAgent string
 	retries   int
+	schemes   sync.Map
+	auth      *auth
+	profiles  *profiles
+	jitter    *hostJitter
+	logger    *slog.Logger
+
+	// Whether results keep their raw response for -store-responses
+	storeResponses bool
+
+	// Requests in a row that failed on the learned scheme, per host
+	schemeFailures sync.Map
+
+	// Clients sending a virtual host's name as the TLS server name
+	sniMutex   sync.Mutex
+	sniClients map[string]*http.Client
+
+	// Called after every request sent, for request budgets
+	requestHook func(url string, err error)
 }
 
 // NewClient creates a new HTTP client with the given configuration
-func NewClient(config *types.Config) *Client {
+func NewClient(config *types.Config, logger *slog.Logger) (*Client, error) {
+	proxy, err := proxyFunc(config.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(config, proxy, logger)
+}
+
+// NewReplayClient creates a client that sends requests through the replay proxy,
+// or returns nil if no replay proxy is configured
+func NewReplayClient(config *types.Config, logger *slog.Logger) (*Client, error) {
+	if config.ReplayProxy == "" {
+		return nil, nil
+	}
+
+	proxy, err := proxyFunc(config.ReplayProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(config, proxy, logger)
+}
+
+// NewCompareClient creates the client that repeats hits for -auth-diff,
+// sending the -auth-diff-* credentials or none, or returns nil if -auth-diff
+// is off
+func NewCompareClient(config *types.Config, logger *slog.Logger) (*Client, error) {
+	if !config.AuthDiff {
+		return nil, nil
+	}
+	if config.AuthBearer == "" && config.AuthBasic == "" && config.AuthLoginURL == "" && config.AuthRefreshCmd == "" && !config.CookieJar {
+		return nil, fmt.Errorf("-auth-diff needs credentials to compare against: -auth-bearer, -auth-basic, a token refresher or -cookie-jar")
+	}
+
+	// The second identity gets its own cookie jar and no token refresher
+	compare := *config
+	compare.AuthBearer = config.AuthDiffBearer
+	compare.AuthBasic = config.AuthDiffBasic
+	compare.AuthLoginURL = ""
+	compare.AuthRefreshCmd = ""
+	compare.AuthCheckURL = ""
+
+	proxy, err := proxyFunc(config.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(&compare, proxy, logger)
+}
+
+// newClient builds the underlying transport and client around a proxy function
+func newClient(config *types.Config, proxy func(*http.Request) (*url.URL, error), logger *slog.Logger) (*Client, error) {
+	tlsConfig, err := buildTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	transport := &http.Transport{
+		Proxy:               proxy,
 		MaxIdleConns:        config.Threads * 2,
 		MaxIdleConnsPerHost: config.Threads,
 		IdleConnTimeout:     30 * time.Second,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-		DisableKeepAlives: false,
+		TLSClientConfig:     tlsConfig,
+		DisableKeepAlives:   false,
+		Protocols:           transportProtocols(config),
 	}
 
 	client := &http.Client{
@@ -43,35 +128,199 @@ func NewClient(config *types.Config) *Client {
 		}
 	}
 
+	if config.CookieJar {
+		// Cookies are kept per host, so sessions set by one target stay with it
+		client.Jar, err = cookiejar.New(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cookie jar: %w", err)
+		}
+	}
+
+	auth, err := newAuth(config, client)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := newProfiles(config)
+	if err != nil {
+		return nil, err
+	}
+	if profiles != nil && !config.HTTP2 && !config.H2C {
+		profiles.orderHeaders(transport)
+	}
+
 	return &Client{
 		client:    client,
 		userAgent: config.UserAgent,
 		retries:   config.MaxRetries,
+		auth:      auth,
+		profiles:  profiles,
+		jitter:    newHostJitter(config.HostJitter),
+		logger:    logger,
+
+		storeResponses: config.StoreResponses,
+	}, nil
+}
+
+// transportProtocols returns the protocols the transport may negotiate. Setting
+// TLSClientConfig disables HTTP/2 unless it is requested explicitly, so plain
+// scans stay on HTTP/1.1.
+func transportProtocols(config *types.Config) *http.Protocols {
+	var protocols http.Protocols
+	switch {
+	case config.H2C:
+		// Prior-knowledge h2c is only used for http:// URLs when HTTP/1 is off
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	case config.HTTP2:
+		// Requests to each host are multiplexed over a single connection
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	default:
+		protocols.SetHTTP1(true)
+	}
+	return &protocols
+}
+
+// proxyFunc returns the proxy function for a proxy URL, falling back to the
+// HTTP_PROXY/HTTPS_PROXY environment variables when none is given
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	if proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", proxy, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use http, https or socks5)", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", proxy)
 	}
+
+	return http.ProxyURL(proxyURL), nil
 }
 
 // MakeRequest makes HTTP request with retries
 func (hc *Client) MakeRequest(ctx context.Context, url string) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
+	return hc.MakeRequestWithHost(ctx, url, "")
+}
+
+// MakeRequestWithHost makes HTTP request with retries, overriding the Host header if host is set
+func (hc *Client) MakeRequestWithHost(ctx context.Context, url, host string) (*http.Response, error) {
+	return hc.Do(ctx, url, RequestOptions{Host: host})
+}
+
+// RequestOptions customizes a single request made through Do
+type RequestOptions struct {
+	Method  string
+	Host    string
+	Headers map[string]string
+	Body    []byte
+}
+
+// Do makes an HTTP request with the given options, retrying on transport
+// errors. A 401 response that means the token expired runs the token
+// refresher, if any, and the request is sent again with the new token.
+func (hc *Client) Do(ctx context.Context, url string, opts RequestOptions) (*http.Response, error) {
+	resp, token, err := hc.do(ctx, url, opts)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized &&
+		hc.tokenExpired(ctx, url, token) && hc.auth.refresh(ctx, token, hc.logger) {
+		resp.Body.Close()
+		resp, token, err = hc.do(ctx, url, opts)
+	}
+	if err == nil && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		hc.auth.succeeded(url, token)
 	}
+	return resp, err
+}
 
-	req.Header.Set("User-Agent", hc.userAgent)
+// do makes a request, retrying on transport errors, and returns the bearer
+// token it was sent with
+func (hc *Client) do(ctx context.Context, url string, opts RequestOptions) (*http.Response, string, error) {
+	method := opts.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	// A different Host header is a virtual host, which needs its name in the SNI too
+	client := hc.client
+	if opts.Host != "" && strings.HasPrefix(url, "https://") {
+		client = hc.sniClient(opts.Host)
+	}
 
 	var resp *http.Response
+	var token string
+	var err error
 	for attempt := 0; attempt <= hc.retries; attempt++ {
-		resp, err = hc.client.Do(req)
+		// Build a fresh request each attempt since a body can only be read once
+		var body io.Reader
+		if opts.Body != nil {
+			body = bytes.NewReader(opts.Body)
+		}
+
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, method, url, body)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if opts.Host != "" {
+			req.Host = opts.Host
+		}
+		if hc.profiles != nil {
+			hc.profiles.apply(req)
+		} else {
+			req.Header.Set("User-Agent", hc.userAgent)
+		}
+		token = hc.auth.apply(req)
+		for name, value := range opts.Headers {
+			req.Header.Set(name, value)
+		}
+
+		if hc.jitter != nil {
+			if err := hc.jitter.wait(ctx, req); err != nil {
+				return nil, "", err
+			}
+		}
+
+		// Connections that reorder headers hide their TLS state from the transport
+		var conn net.Conn
+		if hc.profiles != nil {
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) { conn = info.Conn },
+			}))
+		}
+
+		resp, err = client.Do(req)
+		if hc.requestHook != nil {
+			hc.requestHook(url, err)
+		}
 		if err == nil {
-			return resp, nil
+			if resp.TLS == nil {
+				resp.TLS = connectionState(conn)
+			}
+			return resp, token, nil
 		}
 
 		if attempt < hc.retries {
+			hc.logger.Debug("Retrying request", "url", url, "method", method, "attempt", attempt+1, "error", err)
 			time.Sleep(time.Duration(attempt+1) * 100 * time.Millisecond)
 		}
 	}
 
-	return nil, err
+	return nil, token, err
+}
+
+// SetRequestHook sets a function called after every request the client sends,
+// including retries and the HTTP fallback, with the transport error if any
+func (hc *Client) SetRequestHook(hook func(url string, err error)) {
+	hc.requestHook = hook
 }
 
 // ExtractTitle extracts title from HTML content
@@ -84,6 +333,75 @@ func ExtractTitle(content string) string {
 	return ""
 }
 
+// Fingerprint returns a short hash of a response body, with the host name
+// removed so that identical pages served for different hosts match
+func Fingerprint(body, host string) string {
+	if host != "" {
+		body = strings.ReplaceAll(body, host, "")
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(body))
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// DumpResponse formats a response's status line, headers and body as text
+func DumpResponse(resp *http.Response, body []byte) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\r\n", resp.Proto, resp.Status)
+	resp.Header.Write(&sb)
+	sb.WriteString("\r\n")
+	sb.Write(body)
+	return sb.String()
+}
+
+// ExtractHost returns the host portion of a URL, without scheme, port or path
+func ExtractHost(rawURL string) string {
+	host := strings.TrimPrefix(rawURL, "http://")
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.Split(host, "/")[0]
+	return strings.Split(host, ":")[0]
+}
+
+// IsConnectionError reports whether err means the host did not answer: a
+// timeout, or a connection that was refused, reset or could not be routed.
+// Failed name lookups and TLS errors don't count.
+func IsConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH)
+}
+
+// URLPort returns the port a URL points at, using the scheme's default if none is given
+func URLPort(rawURL string) int {
+	scheme := "https"
+	if strings.HasPrefix(rawURL, "http://") {
+		scheme = "http"
+	}
+
+	hostPort := strings.TrimPrefix(rawURL, scheme+"://")
+	hostPort = strings.Split(hostPort, "/")[0]
+	if _, port, err := net.SplitHostPort(hostPort); err == nil {
+		if p, err := strconv.Atoi(port); err == nil {
+			return p
+		}
+	}
+
+	if scheme == "http" {
+		return 80
+	}
+	return 443
+}
+
 // GenerateURL generates URL based on scan mode
 func GenerateURL(target, word string, mode types.ScanMode) string {
 	target = strings.TrimSuffix(target, "/")
@@ -100,50 +418,48 @@ func GenerateURL(target, word string, mode types.ScanMode) string {
 		domain = strings.TrimPrefix(domain, "https://")
 		domain = strings.Split(domain, "/")[0]
 		return fmt.Sprintf("https://%s.%s", word, domain)
+	case types.ModeVHosts:
+		// Requests always go to the target itself; the word ends up in the Host header
+		return target
+	case types.ModeParams:
+		// Targets are full URLs; words are added as parameters during discovery
+		return target
 	default:
 		return target
 	}
 }
 
-// TestURL tests a single URL and returns the result
-func TestURL(ctx context.Context, httpClient *Client, target, word, url string, statusCodes []int, disableHTTP bool) types.Result {
+// TestURL tests a single URL and returns the result. If compareClient is
+// set, responses with one of statusCodes are requested again through it and
+// the comparison is recorded on the result.
+func TestURL(ctx context.Context, httpClient, compareClient *Client, target, word, url string, statusCodes []int, disableHTTP bool) types.Result {
 	start := time.Now()
 	result := types.Result{
 		Target: target,
 		Word:   word,
 		URL:    url,
+		Method: "GET",
 	}
 
-	// Try HTTPS first
-	httpsURL := url
-	if !strings.HasPrefix(url, "http") {
-		httpsURL = "https://" + url
-	} else if strings.HasPrefix(url, "http://") {
-		httpsURL = strings.Replace(url, "http://", "https://", 1)
-	}
-
-	resp, err := httpClient.MakeRequest(ctx, httpsURL)
-	if err != nil && !disableHTTP {
-		// Fallback to HTTP
-		httpURL := strings.Replace(httpsURL, "https://", "http://", 1)
-		if httpURL != httpsURL {
-			resp, err = httpClient.MakeRequest(ctx, httpURL)
-			if err == nil {
-				result.URL = httpURL
-			}
-		}
+	resp, finalURL, err := httpClient.requestWithFallback(ctx, url, "", disableHTTP)
+	if err == nil {
+		result.URL = finalURL
 	}
 
 	result.ResponseTime = time.Since(start).Milliseconds()
 
 	if err != nil {
 		result.Error = err.Error()
+		result.Unreachable = IsConnectionError(err)
 		return result
 	}
 	defer resp.Body.Close()
 
 	result.StatusCode = resp.StatusCode
 	result.ContentLength = resp.ContentLength
+	result.Protocol = resp.Proto
+	result.Port = URLPort(result.URL)
+	ApplyTLSInfo(&result, resp.TLS)
 
 	// Check if status code is in allowed list
 	allowed := false
@@ -158,9 +474,97 @@ func TestURL(ctx context.Context, httpClient *Client, target, word, url string,
 		// Read response body for title extraction
 		body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024)) // Limit to 1MB
 		if err == nil {
+			// Chunked responses have no Content-Length, so record the bytes read
+			if result.ContentLength < 0 {
+				result.ContentLength = int64(len(body))
+			}
 			result.Title = ExtractTitle(string(body))
+			result.Fingerprint = Fingerprint(string(body), ExtractHost(result.URL))
+			if httpClient.storeResponses {
+				result.Response = DumpResponse(resp, body)
+			}
+		}
+
+		if compareClient != nil {
+			result.AuthCompare = compareAuth(ctx, compareClient, result)
 		}
 	}
 
 	return result
 }
+
+// compareAuth repeats a request through the comparison client and checks
+// whether it got the same content as the authenticated request
+func compareAuth(ctx context.Context, compareClient *Client, result types.Result) *types.AuthComparison {
+	comparison := &types.AuthComparison{}
+
+	resp, err := compareClient.Do(ctx, result.URL, RequestOptions{Method: result.Method, Host: result.Host})
+	if err != nil {
+		comparison.Error = err.Error()
+		return comparison
+	}
+	defer resp.Body.Close()
+
+	comparison.StatusCode = resp.StatusCode
+	comparison.ContentLength = resp.ContentLength
+
+	// Equal sizes say little about the content, so they only count when one
+	// of the bodies could not be read
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	var same bool
+	if err == nil && result.Fingerprint != "" {
+		same = Fingerprint(string(body), ExtractHost(result.URL)) == result.Fingerprint
+	} else {
+		same = comparison.ContentLength >= 0 && comparison.ContentLength == result.ContentLength
+	}
+	comparison.Unprotected = comparison.StatusCode == result.StatusCode && same
+
+	return comparison
+}
+
+// requestWithFallback tries HTTPS first and falls back to HTTP unless disabled.
+// Once a scheme has worked for a host, later requests go straight to it, until
+// it fails several times in a row and both are probed again. It returns the
+// response along with the URL that produced it.
+func (hc *Client) requestWithFallback(ctx context.Context, url, host string, disableHTTP bool) (*http.Response, string, error) {
+	httpsURL := url
+	if !strings.HasPrefix(url, "http") {
+		httpsURL = "https://" + url
+	} else if strings.HasPrefix(url, "http://") {
+		httpsURL = strings.Replace(url, "http://", "https://", 1)
+	}
+	httpURL := strings.Replace(httpsURL, "https://", "http://", 1)
+
+	if scheme, ok := hc.learnedScheme(httpsURL); ok && (scheme == "https" || !disableHTTP) {
+		learnedURL := httpsURL
+		if scheme == "http" {
+			learnedURL = httpURL
+		}
+		resp, err := hc.Do(ctx, learnedURL, RequestOptions{Host: host})
+		if err == nil {
+			hc.schemeWorked(learnedURL)
+			return resp, learnedURL, nil
+		}
+		if ctx.Err() != nil || !hc.schemeFailed(learnedURL) {
+			return resp, learnedURL, err
+		}
+	}
+
+	resp, err := hc.Do(ctx, httpsURL, RequestOptions{Host: host})
+	if err == nil {
+		hc.learnScheme(httpsURL, "https")
+		return resp, httpsURL, nil
+	}
+
+	if !disableHTTP && httpURL != httpsURL {
+		// Fallback to HTTP
+		hc.logger.Debug("HTTPS failed, falling back to HTTP", "url", httpsURL, "error", err)
+		resp, err = hc.Do(ctx, httpURL, RequestOptions{Host: host})
+		if err == nil {
+			hc.learnScheme(httpURL, "http")
+			return resp, httpURL, nil
+		}
+	}
+
+	return resp, httpsURL, err
+}
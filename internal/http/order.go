@@ -0,0 +1,198 @@
+package http
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"hash/maphash"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// maxHeaderBlock is how much of a request is collected while looking for the
+// end of its headers before it is written as is
+const maxHeaderBlock = 64 * 1024
+
+// orderHeaders makes transport write the request headers in a random order
+// instead of Go's fixed one (Host, User-Agent, then sorted by name): per
+// request, or the same order for every request to a host when rotating per
+// host. It only applies to HTTP/1.1, and not inside the TLS tunnel of an
+// HTTPS request through a proxy.
+func (p *profiles) orderHeaders(transport *http.Transport) {
+	dialer := &net.Dialer{}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &orderedConn{Conn: conn, profiles: p}, nil
+	}
+
+	// TLS is set up here so the headers can be reordered before encryption
+	config := transport.TLSClientConfig
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig := &tls.Config{}
+		if config != nil {
+			tlsConfig = config.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConfig.NextProtos = []string{"http/1.1"}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &orderedConn{Conn: tlsConn, profiles: p}, nil
+	}
+}
+
+// reorder returns the header block of a request with its header lines in a
+// random order, Host staying first as browsers send it. It also returns the
+// length of the body that follows, and whether the rest of the connection has
+// to be written as is: after a CONNECT, or a chunked body whose end is unknown.
+func (p *profiles) reorder(block []byte) ([]byte, int64, bool) {
+	lines := bytes.Split(bytes.TrimSuffix(block, []byte("\r\n\r\n")), []byte("\r\n"))
+	if bytes.HasPrefix(lines[0], []byte("CONNECT ")) {
+		return block, 0, true
+	}
+
+	var host []byte
+	var headers [][]byte
+	var length int64
+	raw := false
+	for _, line := range lines[1:] {
+		name, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimSpace(value)
+		switch string(bytes.ToLower(name)) {
+		case "host":
+			host = line
+			continue
+		case "content-length":
+			length, _ = strconv.ParseInt(string(value), 10, 64)
+		case "transfer-encoding":
+			raw = true
+		}
+		headers = append(headers, line)
+	}
+
+	// Sorting by a hash of the names keyed per host keeps a host's order
+	// the same for every request, whichever headers it has
+	var key uint64
+	if p.rotate == RotateHost && host != nil {
+		_, value, _ := bytes.Cut(host, []byte(":"))
+		key = maphash.Bytes(p.seed, bytes.TrimSpace(value))
+	} else {
+		key = rand.Uint64()
+	}
+	ranks := make(map[string]uint64, len(headers))
+	for _, line := range headers {
+		name, _, _ := bytes.Cut(line, []byte(":"))
+		ranks[string(name)] = maphash.Bytes(p.seed, binary.LittleEndian.AppendUint64(bytes.ToLower(name), key))
+	}
+	slices.SortStableFunc(headers, func(a, b []byte) int {
+		nameA, _, _ := bytes.Cut(a, []byte(":"))
+		nameB, _, _ := bytes.Cut(b, []byte(":"))
+		return cmp.Compare(ranks[string(nameA)], ranks[string(nameB)])
+	})
+
+	out := make([]byte, 0, len(block))
+	out = append(out, lines[0]...)
+	out = append(out, "\r\n"...)
+	if host != nil {
+		out = append(out, host...)
+		out = append(out, "\r\n"...)
+	}
+	for _, line := range headers {
+		out = append(out, line...)
+		out = append(out, "\r\n"...)
+	}
+	out = append(out, "\r\n"...)
+	return out, length, raw
+}
+
+// orderedConn reorders the headers of the HTTP/1.1 requests written to it.
+// Anything else, like a SOCKS handshake or TLS through a proxy tunnel, is
+// written as is.
+type orderedConn struct {
+	net.Conn
+	profiles *profiles
+
+	header []byte // start of a request, up to the end of its headers
+	body   int64  // bytes of the current request's body still to write
+	raw    bool
+}
+
+func (c *orderedConn) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		switch {
+		case c.raw:
+			if _, err := c.Conn.Write(p); err != nil {
+				return 0, err
+			}
+			return n, nil
+
+		case c.body > 0:
+			part := p[:min(int64(len(p)), c.body)]
+			if _, err := c.Conn.Write(part); err != nil {
+				return 0, err
+			}
+			c.body -= int64(len(part))
+			p = p[len(part):]
+
+		case len(c.header) == 0 && (p[0] < 'A' || p[0] > 'Z'):
+			// Requests start with a method; this is some other protocol
+			c.raw = true
+
+		default:
+			c.header = append(c.header, p...)
+			p = nil
+
+			end := bytes.Index(c.header, []byte("\r\n\r\n"))
+			if end < 0 {
+				if len(c.header) > maxHeaderBlock {
+					p, c.header, c.raw = c.header, nil, true
+				}
+				continue
+			}
+
+			block, rest := c.header[:end+4], c.header[end+4:]
+			c.header = nil
+			var out []byte
+			out, c.body, c.raw = c.profiles.reorder(block)
+			if _, err := c.Conn.Write(out); err != nil {
+				return 0, err
+			}
+			p = rest
+		}
+	}
+	return n, nil
+}
+
+// connectionState returns the TLS state of a connection from orderHeaders,
+// which the transport can't see through the wrapper
+func connectionState(conn net.Conn) *tls.ConnectionState {
+	ordered, ok := conn.(*orderedConn)
+	if !ok {
+		return nil
+	}
+	tlsConn, ok := ordered.Conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	return &state
+}
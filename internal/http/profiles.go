@@ -0,0 +1,176 @@
+package http
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"hash/maphash"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// Rotation modes for request profiles
+const (
+	RotateRequest = "request"
+	RotateHost    = "host"
+)
+
+//go:embed user_agents.txt
+var defaultUserAgents string
+
+// acceptValues are Accept headers sent by browsers and API clients
+var acceptValues = []string{
+	"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+	"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+	"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+	"application/json, text/plain, */*",
+	"*/*",
+}
+
+// acceptLanguages are Accept-Language headers sent by browsers
+var acceptLanguages = []string{
+	"en-US,en;q=0.9",
+	"en-US,en;q=0.5",
+	"en-GB,en;q=0.9",
+	"de-DE,de;q=0.9,en;q=0.8",
+	"fr-FR,fr;q=0.9,en;q=0.8",
+}
+
+// optionalHeaders are sent by some browsers and not others; each profile
+// includes a random subset. Accept-Encoding is left to the transport, which
+// only decompresses responses to its own gzip request.
+var optionalHeaders = [][2]string{
+	{"Cache-Control", "no-cache"},
+	{"Pragma", "no-cache"},
+	{"DNT", "1"},
+	{"Upgrade-Insecure-Requests", "1"},
+	{"Sec-Fetch-Dest", "document"},
+	{"Sec-Fetch-Mode", "navigate"},
+	{"Sec-Fetch-Site", "none"},
+}
+
+// profile is a set of request headers that looks like one client
+type profile map[string]string
+
+// profiles picks request profiles per request or per host
+type profiles struct {
+	rotate     string
+	userAgents []string
+	hosts      sync.Map // host -> profile
+	seed       maphash.Seed
+}
+
+// newProfiles builds the profiles from the -rotate and -user-agents options,
+// or returns nil if rotation is off
+func newProfiles(config *types.Config) (*profiles, error) {
+	switch config.Rotate {
+	case "":
+		return nil, nil
+	case RotateRequest, RotateHost:
+	default:
+		return nil, fmt.Errorf("invalid -rotate %q (use request or host)", config.Rotate)
+	}
+
+	list := defaultUserAgents
+	if config.UserAgentsFile != "" {
+		data, err := os.ReadFile(config.UserAgentsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read user agents: %w", err)
+		}
+		list = string(data)
+	}
+
+	var userAgents []string
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			userAgents = append(userAgents, line)
+		}
+	}
+	if len(userAgents) == 0 {
+		return nil, fmt.Errorf("no user agents in %s", config.UserAgentsFile)
+	}
+
+	return &profiles{rotate: config.Rotate, userAgents: userAgents, seed: maphash.MakeSeed()}, nil
+}
+
+// random builds a new profile
+func (p *profiles) random() profile {
+	headers := profile{
+		"User-Agent":      p.userAgents[rand.IntN(len(p.userAgents))],
+		"Accept":          acceptValues[rand.IntN(len(acceptValues))],
+		"Accept-Language": acceptLanguages[rand.IntN(len(acceptLanguages))],
+	}
+	for _, header := range optionalHeaders {
+		if rand.IntN(2) == 0 {
+			headers[header[0]] = header[1]
+		}
+	}
+	return headers
+}
+
+// apply sets the headers of a profile on a request, keeping one profile per
+// host when rotating per host
+func (p *profiles) apply(req *http.Request) {
+	headers := p.random()
+	if p.rotate == RotateHost {
+		existing, _ := p.hosts.LoadOrStore(requestHost(req), headers)
+		headers = existing.(profile)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// hostJitter spaces out requests to the same host by a random delay
+type hostJitter struct {
+	max   time.Duration
+	mutex sync.Mutex
+	next  map[string]time.Time
+}
+
+// newHostJitter returns a jitter of up to max between requests to a host, or
+// nil if max is zero
+func newHostJitter(max time.Duration) *hostJitter {
+	if max <= 0 {
+		return nil
+	}
+	return &hostJitter{max: max, next: make(map[string]time.Time)}
+}
+
+// wait blocks until the request's turn for its host comes up
+func (j *hostJitter) wait(ctx context.Context, req *http.Request) error {
+	host := requestHost(req)
+
+	j.mutex.Lock()
+	slot := time.Now()
+	if next, ok := j.next[host]; ok && next.After(slot) {
+		slot = next
+	}
+	j.next[host] = slot.Add(rand.N(j.max))
+	j.mutex.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requestHost returns the host a request is addressed to, using the Host
+// header override in vhosts mode
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// maxSchemeFailures is how many requests in a row may fail on a learned
+// scheme before it is forgotten and both schemes are probed again
+const maxSchemeFailures = 3
+
+// schemeKey returns the host[:port] that a URL's working scheme is remembered under
+func schemeKey(url string) string {
+	host := strings.TrimPrefix(url, "http://")
+	host = strings.TrimPrefix(host, "https://")
+	return strings.ToLower(strings.Split(host, "/")[0])
+}
+
+// learnedScheme returns the scheme that worked for the URL's host before, if any
+func (hc *Client) learnedScheme(url string) (string, bool) {
+	scheme, ok := hc.schemes.Load(schemeKey(url))
+	if !ok {
+		return "", false
+	}
+	return scheme.(string), true
+}
+
+// learnScheme remembers that scheme worked for the URL's host
+func (hc *Client) learnScheme(url, scheme string) {
+	hc.schemes.Store(schemeKey(url), scheme)
+	hc.schemeFailures.Delete(schemeKey(url))
+}
+
+// schemeWorked resets the failures counted for the URL's learned scheme
+func (hc *Client) schemeWorked(url string) {
+	key := schemeKey(url)
+	if _, ok := hc.schemeFailures.Load(key); ok {
+		hc.schemeFailures.Delete(key)
+	}
+}
+
+// schemeFailed counts a failed request on the URL's learned scheme and
+// reports whether the scheme was forgotten because it keeps failing, e.g.
+// after a transient HTTPS error pinned the host to HTTP
+func (hc *Client) schemeFailed(url string) bool {
+	key := schemeKey(url)
+	value, _ := hc.schemeFailures.LoadOrStore(key, new(atomic.Int64))
+	if value.(*atomic.Int64).Add(1) < maxSchemeFailures {
+		return false
+	}
+
+	hc.schemes.Delete(key)
+	hc.schemeFailures.Delete(key)
+	hc.logger.Debug("Learned scheme keeps failing, probing both again", "host", key)
+	return true
+}
+
+// Schemes returns a snapshot of the scheme learned for each host
+func (hc *Client) Schemes() map[string]string {
+	schemes := make(map[string]string)
+	hc.schemes.Range(func(key, value interface{}) bool {
+		schemes[key.(string)] = value.(string)
+		return true
+	})
+	return schemes
+}
+
+// LoadSchemes seeds the learned schemes, e.g. from a resumed scan
+func (hc *Client) LoadSchemes(schemes map[string]string) {
+	for host, scheme := range schemes {
+		hc.schemes.Store(host, scheme)
+	}
+}
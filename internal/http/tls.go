@@ -0,0 +1,98 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// tlsVersions maps the -tls-min-version flag values to crypto/tls constants
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// buildTLSConfig creates the TLS configuration for the transport from the
+// verification, client certificate, SNI and version options
+func buildTLSConfig(config *types.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: !config.TLSVerify,
+		ServerName:         config.TLSServerName,
+	}
+
+	if config.TLSMinVersion != "" {
+		version, ok := tlsVersions[config.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version %q (use 1.0, 1.1, 1.2 or 1.3)", config.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if config.TLSCAFile != "" {
+		pem, err := os.ReadFile(config.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", config.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.TLSClientCert != "" {
+		// The key may live in the same PEM file as the certificate
+		keyFile := config.TLSClientKey
+		if keyFile == "" {
+			keyFile = config.TLSClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(config.TLSClientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// ApplyTLSInfo records the peer certificate details of a response on the result
+func ApplyTLSInfo(result *types.Result, state *tls.ConnectionState) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	cert := state.PeerCertificates[0]
+	result.TLSSubject = cert.Subject.CommonName
+	result.TLSIssuer = cert.Issuer.CommonName
+	result.TLSSANs = strings.Join(cert.DNSNames, ";")
+	result.TLSNotAfter = cert.NotAfter.UTC().Format(time.RFC3339)
+}
+
+// SANHostnames returns the hostnames from a result's certificate that fall
+// under domain, excluding wildcards and the domain itself
+func SANHostnames(result types.Result, domain string) []string {
+	if result.TLSSANs == "" {
+		return nil
+	}
+
+	domain = strings.ToLower(domain)
+	var hosts []string
+	for _, san := range strings.Split(result.TLSSANs, ";") {
+		san = strings.ToLower(strings.TrimSuffix(san, "."))
+		if strings.HasPrefix(san, "*.") || san == domain {
+			continue
+		}
+		if strings.HasSuffix(san, "."+domain) {
+			hosts = append(hosts, san)
+		}
+	}
+	return hosts
+}
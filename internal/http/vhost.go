@@ -0,0 +1,159 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// GenerateVHost builds the Host header value for a word in vhosts mode.
+// Without a domain the word itself is used as the full host name.
+func GenerateVHost(word, domain string) string {
+	word = strings.Trim(word, "/.")
+	if domain == "" {
+		return word
+	}
+	return word + "." + strings.TrimPrefix(domain, ".")
+}
+
+// RandomWord returns a word that is very unlikely to exist on any target
+func RandomWord() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return "apispray-" + hex.EncodeToString(buf)
+}
+
+// RandomVHost returns a host name under domain that is very unlikely to exist,
+// used to record what the server returns for unknown virtual hosts
+func RandomVHost(domain string) string {
+	label := RandomWord()
+	if domain == "" {
+		return label + ".invalid"
+	}
+	return GenerateVHost(label, domain)
+}
+
+// VHostDomain returns the domain to append to words for a vhosts target.
+// An explicit domain wins; otherwise hostname targets are used as the domain
+// and IP targets get no domain at all.
+func VHostDomain(target, domain string) string {
+	if domain != "" {
+		return domain
+	}
+	host := ExtractHost(target)
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	return host
+}
+
+// TestVHost requests url with the given Host header and returns the result along
+// with the body size normalized for reflections of the host name, so that it can
+// be compared against a baseline taken with a different host
+func TestVHost(ctx context.Context, httpClient *Client, target, word, url, host string, statusCodes []int, disableHTTP bool) (types.Result, int64) {
+	start := time.Now()
+	result := types.Result{
+		Target: target,
+		Word:   word,
+		URL:    url,
+		Method: "GET",
+		Host:   host,
+	}
+
+	resp, finalURL, err := httpClient.requestWithFallback(ctx, url, host, disableHTTP)
+	if err == nil {
+		result.URL = finalURL
+	}
+
+	result.ResponseTime = time.Since(start).Milliseconds()
+
+	if err != nil {
+		result.Error = err.Error()
+		result.Unreachable = IsConnectionError(err)
+		return result, 0
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.ContentLength = resp.ContentLength
+	result.Protocol = resp.Proto
+	result.Port = URLPort(result.URL)
+	ApplyTLSInfo(&result, resp.TLS)
+
+	// Always read the body, since the baseline comparison needs its size
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024)) // Limit to 1MB
+	if err != nil {
+		return result, result.ContentLength
+	}
+	if result.ContentLength < 0 {
+		result.ContentLength = int64(len(body))
+	}
+	result.Fingerprint = Fingerprint(string(body), host)
+
+	for _, code := range statusCodes {
+		if resp.StatusCode == code {
+			result.Title = ExtractTitle(string(body))
+			if httpClient.storeResponses {
+				result.Response = DumpResponse(resp, body)
+			}
+			break
+		}
+	}
+
+	// Servers often echo the Host header back, so strip it before measuring
+	normalized := int64(len(body) - strings.Count(string(body), host)*len(host))
+
+	return result, normalized
+}
+
+// maxSNIClients bounds how many server names keep a client of their own
+const maxSNIClients = 256
+
+// sniClient returns a client that sends host as the TLS server name, so
+// HTTPS virtual hosts routed by SNI are reached. Idle connections are pooled
+// by address rather than server name, so each name gets a transport of its
+// own, kept for the requests that follow. An explicit -sni wins.
+func (hc *Client) sniClient(host string) *http.Client {
+	transport, ok := hc.client.Transport.(*http.Transport)
+	if !ok || transport.TLSClientConfig == nil || transport.TLSClientConfig.ServerName != "" {
+		return hc.client
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+
+	hc.sniMutex.Lock()
+	defer hc.sniMutex.Unlock()
+	if client, ok := hc.sniClients[host]; ok {
+		return client
+	}
+
+	transport = transport.Clone()
+	transport.TLSClientConfig.ServerName = host
+	if transport.DialTLSContext != nil {
+		hc.profiles.orderHeaders(transport)
+	}
+	client := *hc.client
+	client.Transport = transport
+
+	if hc.sniClients == nil {
+		hc.sniClients = make(map[string]*http.Client)
+	}
+	if len(hc.sniClients) >= maxSNIClients {
+		// Make room by dropping any one of them, closing its idle connections
+		for name, old := range hc.sniClients {
+			old.CloseIdleConnections()
+			delete(hc.sniClients, name)
+			break
+		}
+	}
+	hc.sniClients[host] = &client
+	return &client
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// Log formats supported by New
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New creates the console logger for a scan. Info and above is shown by
+// default, debug events such as failed requests with -v, and only warnings
+// and errors with -q.
+func New(config *types.Config) (*slog.Logger, error) {
+	level := slog.LevelInfo
+	switch {
+	case config.Verbose:
+		level = slog.LevelDebug
+	case config.Quiet:
+		level = slog.LevelWarn
+	}
+
+	handler, err := newHandler(Console, config.LogFormat, level, true)
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(handler), nil
+}
+
+// NewHandler creates a handler writing every event at level or above to w
+func NewHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	return newHandler(w, format, level, false)
+}
+
+// Nop returns a logger that discards everything
+func Nop() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// newHandler creates a text or JSON handler. Console text output only shows
+// the time of day to keep lines short.
+func newHandler(w io.Writer, format string, level slog.Leveler, console bool) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch format {
+	case FormatText, "":
+		if console {
+			opts.ReplaceAttr = shortTime
+		}
+		return slog.NewTextHandler(w, opts), nil
+	case FormatJSON:
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", format)
+	}
+}
+
+// shortTime formats the event time as 15:04:05
+func shortTime(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey && len(groups) == 0 {
+		return slog.String(slog.TimeKey, a.Value.Time().Format("15:04:05"))
+	}
+	return a
+}
+
+// Console is where console loggers write: os.Stderr, unless the dashboard
+// redirects it to write log lines above its status block
+var Console = &Redirect{}
+
+// Redirect writes to os.Stderr, or to the writer set with Set
+type Redirect struct {
+	mutex sync.RWMutex
+	w     io.Writer
+}
+
+// Set sends writes to w, or back to os.Stderr when w is nil
+func (r *Redirect) Set(w io.Writer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.w = w
+}
+
+func (r *Redirect) Write(p []byte) (int, error) {
+	r.mutex.RLock()
+	w := r.w
+	r.mutex.RUnlock()
+
+	if w == nil {
+		w = os.Stderr
+	}
+	return w.Write(p)
+}
@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the response time histogram
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Status is the scan state served on /status. Its fields mirror the progress
+// file, with the live statistics alongside.
+type Status struct {
+	LastBatch      int             `json:"last_batch"`
+	CurrentBatch   int             `json:"current_batch"`
+	TotalBatches   int             `json:"total_batches"`
+	CompletedCount int             `json:"completed_count"`
+	TotalWork      int             `json:"total_work"`
+	StartTime      time.Time       `json:"start_time"`
+	QueueDepth     int64           `json:"queue_depth"`
+	Stats          types.ScanStats `json:"stats"`
+}
+
+// hostCounts holds the request and error counters of a single host
+type hostCounts struct {
+	requests int64
+	errors   int64
+}
+
+// Server exposes scan metrics in the Prometheus text format on /metrics and
+// the scan status as JSON on /status
+type Server struct {
+	addr   string
+	status func() Status
+	server *http.Server
+
+	// Response time histogram; the last bucket is +Inf
+	buckets    []int64
+	latencySum int64 // milliseconds
+	latencyN   int64
+
+	hostMutex sync.Mutex
+	hosts     map[string]*hostCounts
+}
+
+// New creates a metrics server listening on addr, reading the scan state from status
+func New(addr string, status func() Status) *Server {
+	return &Server{
+		addr:    addr,
+		status:  status,
+		buckets: make([]int64, len(latencyBuckets)+1),
+		hosts:   make(map[string]*hostCounts),
+	}
+}
+
+// Start starts serving in the background once the address is bound
+func (m *Server) Start() error {
+	listener, err := net.Listen("tcp", m.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", m.handleMetrics)
+	mux.HandleFunc("GET /status", m.handleStatus)
+	m.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go m.server.Serve(listener)
+	return nil
+}
+
+// Stop shuts the server down
+func (m *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m.server.Shutdown(ctx)
+}
+
+// Observe records the response time of a result and counts it for host
+func (m *Server) Observe(host string, result types.Result) {
+	if result.Error == "" {
+		seconds := float64(result.ResponseTime) / 1000
+		bucket := sort.SearchFloat64s(latencyBuckets, seconds)
+		atomic.AddInt64(&m.buckets[bucket], 1)
+		atomic.AddInt64(&m.latencySum, result.ResponseTime)
+		atomic.AddInt64(&m.latencyN, 1)
+	}
+
+	m.hostMutex.Lock()
+	defer m.hostMutex.Unlock()
+
+	counts, ok := m.hosts[host]
+	if !ok {
+		counts = &hostCounts{}
+		m.hosts[host] = counts
+	}
+	counts.requests++
+	if result.Error != "" {
+		counts.errors++
+	}
+}
+
+// handleStatus serves the scan status as JSON
+func (m *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(m.status())
+}
+
+// handleMetrics serves the metrics in the Prometheus text format
+func (m *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteMetrics(w)
+}
+
+// WriteMetrics writes all metrics to w in the Prometheus text format
+func (m *Server) WriteMetrics(w io.Writer) {
+	status := m.status()
+	stats := status.Stats
+
+	writeMetric(w, "api_spray_requests_total", "counter", "Requests sent", stats.TotalRequests)
+	writeMetric(w, "api_spray_success_total", "counter", "Responses with a matching status code", stats.SuccessCount)
+	writeMetric(w, "api_spray_errors_total", "counter", "Failed requests and responses with other status codes", stats.ErrorCount)
+	writeMetric(w, "api_spray_timeouts_total", "counter", "Requests that timed out", stats.TimeoutCount)
+	writeMetric(w, "api_spray_filtered_total", "counter", "Responses filtered as false positives", stats.FilteredCount)
+	writeMetric(w, "api_spray_work_completed", "gauge", "Work items completed, including before a resume", int64(status.CompletedCount))
+	writeMetric(w, "api_spray_work_total", "gauge", "Work items in the scan", int64(status.TotalWork))
+	writeMetric(w, "api_spray_batch", "gauge", "Batch currently being processed", int64(status.CurrentBatch))
+	writeMetric(w, "api_spray_batches", "gauge", "Batches in the scan", int64(status.TotalBatches))
+	writeMetric(w, "api_spray_queue_depth", "gauge", "Work items queued for the workers", status.QueueDepth)
+
+	// Response time histogram, with cumulative buckets
+	fmt.Fprintln(w, "# HELP api_spray_response_time_seconds Response time of requests that got a response")
+	fmt.Fprintln(w, "# TYPE api_spray_response_time_seconds histogram")
+	var cumulative int64
+	for i, bound := range latencyBuckets {
+		cumulative += atomic.LoadInt64(&m.buckets[i])
+		fmt.Fprintf(w, "api_spray_response_time_seconds_bucket{le=\"%g\"} %d\n", bound, cumulative)
+	}
+	cumulative += atomic.LoadInt64(&m.buckets[len(latencyBuckets)])
+	fmt.Fprintf(w, "api_spray_response_time_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintf(w, "api_spray_response_time_seconds_sum %g\n", float64(atomic.LoadInt64(&m.latencySum))/1000)
+	fmt.Fprintf(w, "api_spray_response_time_seconds_count %d\n", atomic.LoadInt64(&m.latencyN))
+
+	// Per-host counters, from which error rates can be derived
+	m.hostMutex.Lock()
+	hosts := make([]string, 0, len(m.hosts))
+	for host := range m.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	fmt.Fprintln(w, "# HELP api_spray_host_requests_total Requests sent per host")
+	fmt.Fprintln(w, "# TYPE api_spray_host_requests_total counter")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "api_spray_host_requests_total{host=\"%s\"} %d\n", escapeLabel(host), m.hosts[host].requests)
+	}
+	fmt.Fprintln(w, "# HELP api_spray_host_errors_total Failed requests per host")
+	fmt.Fprintln(w, "# TYPE api_spray_host_errors_total counter")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "api_spray_host_errors_total{host=\"%s\"} %d\n", escapeLabel(host), m.hosts[host].errors)
+	}
+	m.hostMutex.Unlock()
+}
+
+// writeMetric writes a single unlabeled metric with its help and type lines
+func writeMetric(w io.Writer, name, kind, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
+
+// escapeLabel escapes a label value for the text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
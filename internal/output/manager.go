@@ -1,30 +1,53 @@
 package output
 
 import (
+	"crypto/sha1"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/davidwkirsch/api_spray/internal/logging"
 	"github.com/davidwkirsch/api_spray/pkg/types"
 )
 
 // Manager handles all output operations
 type Manager struct {
-	csvWriter  *csv.Writer
-	csvFile    *os.File
-	logFile    *os.File
-	writeMutex sync.Mutex
-	outDir     string
+	csvWriter      *csv.Writer
+	csvFile        *os.File
+	jsonlFile      *os.File
+	logFile        *os.File
+	errorFile      *os.File
+	errorLog       *slog.Logger
+	takeoverWriter *csv.Writer
+	takeoverFile   *os.File
+	bypassWriter   *csv.Writer
+	bypassFile     *os.File
+	writeMutex     sync.Mutex
+	outDir         string
+	storeResponses bool
+	jsonl          bool
+	logFormat      string
+	logger         *slog.Logger
 }
 
-// NewManager creates a new output manager
-func NewManager(outDir string) *Manager {
+// NewManager creates a new output manager for the configured output directory.
+// With StoreResponses, the raw response of every saved result is written to
+// the responses directory, and with JSONL every result is also written to
+// results.jsonl. Saved results are also logged to logger.
+func NewManager(config *types.Config, logger *slog.Logger) *Manager {
 	return &Manager{
-		outDir: outDir,
+		outDir:         config.OutDir,
+		storeResponses: config.StoreResponses,
+		jsonl:          config.JSONL,
+		logFormat:      config.LogFormat,
+		logger:         logger,
 	}
 }
 
@@ -35,8 +58,15 @@ func (om *Manager) Initialize() error {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
+	if om.storeResponses {
+		if err := os.MkdirAll(fmt.Sprintf("%s/responses", om.outDir), 0755); err != nil {
+			return fmt.Errorf("failed to create responses directory: %w", err)
+		}
+	}
+
 	csvPath := fmt.Sprintf("%s/results.csv", om.outDir)
 	logPath := fmt.Sprintf("%s/scan.log", om.outDir)
+	errorPath := fmt.Sprintf("%s/errors.log", om.outDir)
 
 	// Check if files exist for resume
 	csvExists := false
@@ -59,19 +89,36 @@ func (om *Manager) Initialize() error {
 
 	// Write CSV header if new file
 	if !csvExists {
-		header := []string{"target", "word", "url", "status_code", "content_length", "response_time_ms", "title", "error"}
-		if err := om.csvWriter.Write(header); err != nil {
+		if err := om.csvWriter.Write(resultHeader); err != nil {
 			return fmt.Errorf("failed to write CSV header: %w", err)
 		}
 		om.csvWriter.Flush()
 	}
 
+	if om.jsonl {
+		om.jsonlFile, err = os.OpenFile(fmt.Sprintf("%s/results.jsonl", om.outDir), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open JSONL file: %w", err)
+		}
+	}
+
 	// Open log file
 	om.logFile, err = os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 
+	// Request failures are logged in the same format as the console
+	om.errorFile, err = os.OpenFile(errorPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open error log file: %w", err)
+	}
+	handler, err := logging.NewHandler(om.errorFile, om.logFormat, slog.LevelDebug)
+	if err != nil {
+		return err
+	}
+	om.errorLog = slog.New(handler)
+
 	return nil
 }
 
@@ -80,38 +127,238 @@ func (om *Manager) WriteResult(result types.Result) error {
 	om.writeMutex.Lock()
 	defer om.writeMutex.Unlock()
 
-	// Write to CSV
-	record := []string{
-		result.Target,
-		result.Word,
-		result.URL,
-		strconv.Itoa(result.StatusCode),
-		strconv.FormatInt(result.ContentLength, 10),
-		strconv.FormatInt(result.ResponseTime, 10),
-		result.Title,
-		result.Error,
+	// Store the raw response first so the CSV row can point at it
+	if om.storeResponses && result.Response != "" {
+		responseFile, err := om.writeResponse(result)
+		if err != nil {
+			return fmt.Errorf("failed to store response: %w", err)
+		}
+		result.ResponseFile = responseFile
 	}
 
+	// Write to CSV
+	record := resultRecord(result)
+
 	if err := om.csvWriter.Write(record); err != nil {
 		return err
 	}
 	om.csvWriter.Flush()
 
+	if om.jsonlFile != nil {
+		line, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to marshal result: %w", err)
+		}
+		if _, err := om.jsonlFile.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
 	// Write to log if successful
 	if result.StatusCode > 0 && result.Error == "" {
+		url := result.URL
+		if result.Host != "" {
+			url = fmt.Sprintf("%s (Host: %s)", result.URL, result.Host)
+		}
 		logEntry := fmt.Sprintf("[%s] %s [%d] [%d] %dms\n",
 			time.Now().Format("15:04:05"),
-			result.URL,
+			url,
 			result.StatusCode,
 			result.ContentLength,
 			result.ResponseTime,
 		)
 		om.logFile.WriteString(logEntry)
+
+		attrs := []any{"target", result.Target, "word", result.Word, "url", result.URL,
+			"status", result.StatusCode, "size", result.ContentLength, "time_ms", result.ResponseTime}
+		if result.Host != "" {
+			attrs = append(attrs, "host", result.Host)
+		}
+		if c := result.AuthCompare; c != nil {
+			attrs = append(attrs, "compare_status", c.StatusCode, "compare_size", c.ContentLength, "unprotected", c.Unprotected)
+		}
+		om.logger.Info("Found", attrs...)
+	}
+
+	return nil
+}
+
+// WriteError records a failed request in errors.log
+func (om *Manager) WriteError(result types.Result) {
+	attrs := []any{"target", result.Target, "word", result.Word, "url", result.URL, "error", result.Error}
+	if result.Host != "" {
+		attrs = append(attrs, "host", result.Host)
+	}
+	om.errorLog.Error("Request failed", attrs...)
+}
+
+// writeResponse writes a result's raw response to the responses directory and
+// returns its path relative to the output directory
+func (om *Manager) writeResponse(result types.Result) (string, error) {
+	hash := sha1.Sum([]byte(result.URL + "|" + result.Host + "|" + result.Word))
+	name := fmt.Sprintf("responses/%s.txt", hex.EncodeToString(hash[:8]))
+
+	path := fmt.Sprintf("%s/%s", om.outDir, name)
+	if err := os.WriteFile(path, []byte(result.Response), 0644); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// WriteStats saves a statistics snapshot to stats.json
+func (om *Manager) WriteStats(stats types.ScanStats) error {
+	return writeStats(om.outDir, stats)
+}
+
+// writeStats saves a statistics snapshot to stats.json in outDir
+func writeStats(outDir string, stats types.ScanStats) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+
+	return os.WriteFile(fmt.Sprintf("%s/stats.json", outDir), data, 0644)
+}
+
+// ReadStats loads the statistics snapshot saved in an output directory
+func ReadStats(outDir string) (*types.ScanStats, error) {
+	data, err := os.ReadFile(fmt.Sprintf("%s/stats.json", outDir))
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &types.ScanStats{}
+	if err := json.Unmarshal(data, stats); err != nil {
+		return nil, fmt.Errorf("failed to parse stats file: %w", err)
+	}
+	return stats, nil
+}
+
+// WriteTakeover writes a potential subdomain takeover to takeovers.csv
+func (om *Manager) WriteTakeover(result types.TakeoverResult) error {
+	om.writeMutex.Lock()
+	defer om.writeMutex.Unlock()
+
+	// Open lazily so scans without findings don't leave an empty file behind
+	if om.takeoverWriter == nil {
+		file, writer, err := om.openFindings("takeovers.csv", []string{"target", "host", "cname", "service", "evidence"})
+		if err != nil {
+			return fmt.Errorf("failed to open takeover file: %w", err)
+		}
+		om.takeoverFile = file
+		om.takeoverWriter = writer
+	}
+
+	record := []string{
+		result.Target,
+		result.Host,
+		result.CNAME,
+		result.Service,
+		result.Evidence,
+	}
+
+	if err := om.takeoverWriter.Write(record); err != nil {
+		return err
+	}
+	om.takeoverWriter.Flush()
+
+	logEntry := fmt.Sprintf("[%s] POTENTIAL TAKEOVER %s -> %s (%s)\n",
+		time.Now().Format("15:04:05"),
+		result.Host,
+		result.CNAME,
+		result.Service,
+	)
+	om.logFile.WriteString(logEntry)
+
+	om.logger.Info("Potential takeover", "target", result.Target, "host", result.Host,
+		"cname", result.CNAME, "service", result.Service)
+
+	return nil
+}
+
+// WriteBypass writes a 401 or 403 bypass to bypasses.csv
+func (om *Manager) WriteBypass(result types.BypassResult) error {
+	om.writeMutex.Lock()
+	defer om.writeMutex.Unlock()
+
+	if om.bypassWriter == nil {
+		file, writer, err := om.openFindings("bypasses.csv", []string{
+			"target", "word", "url", "status_code", "content_length",
+			"technique", "method", "bypass_url", "header", "bypass_status", "bypass_length",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to open bypass file: %w", err)
+		}
+		om.bypassFile = file
+		om.bypassWriter = writer
+	}
+
+	record := []string{
+		result.Target,
+		result.Word,
+		result.URL,
+		strconv.Itoa(result.StatusCode),
+		strconv.FormatInt(result.ContentLength, 10),
+		result.Technique,
+		result.Method,
+		result.BypassURL,
+		result.Header,
+		strconv.Itoa(result.BypassStatus),
+		strconv.FormatInt(result.BypassLength, 10),
+	}
+
+	if err := om.bypassWriter.Write(record); err != nil {
+		return err
+	}
+	om.bypassWriter.Flush()
+
+	logEntry := fmt.Sprintf("[%s] BYPASS %s %d -> %d via %s (%s %s)\n",
+		time.Now().Format("15:04:05"),
+		result.URL,
+		result.StatusCode,
+		result.BypassStatus,
+		result.Technique,
+		result.Method,
+		result.BypassURL,
+	)
+	om.logFile.WriteString(logEntry)
+
+	attrs := []any{"target", result.Target, "url", result.URL, "status", result.StatusCode,
+		"technique", result.Technique, "method", result.Method, "bypass_url", result.BypassURL,
+		"bypass_status", result.BypassStatus, "bypass_size", result.BypassLength}
+	if result.Header != "" {
+		attrs = append(attrs, "header", result.Header)
 	}
+	om.logger.Info("Bypass found", attrs...)
 
 	return nil
 }
 
+// openFindings opens a findings CSV in the output directory for appending,
+// writing the header if the file is new
+func (om *Manager) openFindings(name string, header []string) (*os.File, *csv.Writer, error) {
+	path := fmt.Sprintf("%s/%s", om.outDir, name)
+
+	exists := false
+	if _, err := os.Stat(path); err == nil {
+		exists = true
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	writer := csv.NewWriter(file)
+
+	if !exists {
+		if err := writer.Write(header); err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to write header: %w", err)
+		}
+	}
+	return file, writer, nil
+}
+
 // Close closes all file handles
 func (om *Manager) Close() error {
 	var errs []error
@@ -124,11 +371,37 @@ func (om *Manager) Close() error {
 			errs = append(errs, err)
 		}
 	}
+	if om.jsonlFile != nil {
+		if err := om.jsonlFile.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if om.takeoverWriter != nil {
+		om.takeoverWriter.Flush()
+	}
+	if om.takeoverFile != nil {
+		if err := om.takeoverFile.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if om.bypassWriter != nil {
+		om.bypassWriter.Flush()
+	}
+	if om.bypassFile != nil {
+		if err := om.bypassFile.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	if om.logFile != nil {
 		if err := om.logFile.Close(); err != nil {
 			errs = append(errs, err)
 		}
 	}
+	if om.errorFile != nil {
+		if err := om.errorFile.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
 	if len(errs) > 0 {
 		return fmt.Errorf("errors closing files: %v", errs)
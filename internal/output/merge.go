@@ -0,0 +1,327 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// MergeSummary counts what Merge combined
+type MergeSummary struct {
+	Results    int
+	Duplicates int
+	Takeovers  int
+	Bypasses   int
+	Responses  int
+}
+
+// Merge combines the scans in inputs into outDir. Results are deduplicated by
+// target, word, URL and Host header, keeping the first; stored responses, results.jsonl,
+// takeovers and bypasses are carried over, logs are appended and statistics are summed.
+func Merge(outDir string, inputs []string) (*MergeSummary, error) {
+	for _, input := range inputs {
+		if sameDir(input, outDir) {
+			return nil, fmt.Errorf("output directory %s is also an input", outDir)
+		}
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s/results.csv", outDir)); err == nil {
+		return nil, fmt.Errorf("output directory %s already has results", outDir)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	summary := &MergeSummary{}
+	var err error
+	if err = mergeResults(outDir, inputs, summary); err != nil {
+		return nil, err
+	}
+	if err = mergeJSONL(outDir, inputs); err != nil {
+		return nil, err
+	}
+	if summary.Takeovers, err = mergeFindings(outDir, inputs, "takeovers.csv"); err != nil {
+		return nil, err
+	}
+	if summary.Bypasses, err = mergeFindings(outDir, inputs, "bypasses.csv"); err != nil {
+		return nil, err
+	}
+	if err := mergeStats(outDir, inputs); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"scan.log", "errors.log"} {
+		if err := appendLogs(outDir, inputs, name); err != nil {
+			return nil, err
+		}
+	}
+
+	return summary, nil
+}
+
+// mergeResults writes the unique results of every input to results.csv and
+// copies their stored responses
+func mergeResults(outDir string, inputs []string, summary *MergeSummary) error {
+	file, err := os.Create(fmt.Sprintf("%s/results.csv", outDir))
+	if err != nil {
+		return fmt.Errorf("failed to create CSV file: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(resultHeader); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, input := range inputs {
+		results, err := ReadResults(fmt.Sprintf("%s/results.csv", input))
+		if err != nil {
+			return fmt.Errorf("failed to load results of %s: %w", input, err)
+		}
+
+		for _, result := range results {
+			key := strings.Join([]string{result.Target, result.Word, result.URL, result.Host}, "|")
+			if seen[key] {
+				summary.Duplicates++
+				continue
+			}
+			seen[key] = true
+
+			if result.ResponseFile != "" {
+				if err := copyResponse(input, outDir, result.ResponseFile); err != nil {
+					return err
+				}
+				summary.Responses++
+			}
+
+			if err := writer.Write(resultRecord(result)); err != nil {
+				return err
+			}
+			summary.Results++
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// responseName matches the stored response names Manager writes
+var responseName = regexp.MustCompile(`^responses/[0-9a-f]+\.txt$`)
+
+// ValidResponseName reports whether name is a stored response name as Manager
+// writes them, so a crafted results.csv cannot point outside the output
+// directory
+func ValidResponseName(name string) bool {
+	return responseName.MatchString(name)
+}
+
+// mergeJSONL writes the unique results of the inputs that have a
+// results.jsonl to results.jsonl, deduplicated like results.csv
+func mergeJSONL(outDir string, inputs []string) error {
+	var file *os.File
+	seen := make(map[string]bool)
+
+	for _, input := range inputs {
+		results, err := ReadResultsJSONL(fmt.Sprintf("%s/results.jsonl", input))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load JSONL results of %s: %w", input, err)
+		}
+
+		if file == nil {
+			file, err = os.Create(fmt.Sprintf("%s/results.jsonl", outDir))
+			if err != nil {
+				return fmt.Errorf("failed to create JSONL file: %w", err)
+			}
+			defer file.Close()
+		}
+
+		for _, result := range results {
+			key := strings.Join([]string{result.Target, result.Word, result.URL, result.Host}, "|")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			line, err := json.Marshal(result)
+			if err != nil {
+				return fmt.Errorf("failed to marshal result: %w", err)
+			}
+			if _, err := file.Write(append(line, '\n')); err != nil {
+				return fmt.Errorf("failed to write JSONL file: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// copyResponse copies a stored response between output directories
+func copyResponse(from, to, name string) error {
+	if !ValidResponseName(name) {
+		return fmt.Errorf("invalid stored response name %q in %s", name, from)
+	}
+	data, err := os.ReadFile(fmt.Sprintf("%s/%s", from, name))
+	if err != nil {
+		return fmt.Errorf("failed to read stored response: %w", err)
+	}
+	if err := os.MkdirAll(fmt.Sprintf("%s/responses", to), 0755); err != nil {
+		return fmt.Errorf("failed to create responses directory: %w", err)
+	}
+	return os.WriteFile(fmt.Sprintf("%s/%s", to, name), data, 0644)
+}
+
+// mergeFindings combines the unique rows of a findings CSV, such as
+// takeovers.csv, and returns how many there are
+func mergeFindings(outDir string, inputs []string, name string) (int, error) {
+	var header []string
+	var rows [][]string
+	seen := make(map[string]bool)
+
+	for _, input := range inputs {
+		file, err := os.Open(fmt.Sprintf("%s/%s", input, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+
+		records, err := csv.NewReader(file).ReadAll()
+		file.Close()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s of %s: %w", name, input, err)
+		}
+		if len(records) == 0 {
+			continue
+		}
+
+		header = records[0]
+		for _, record := range records[1:] {
+			key := strings.Join(record, "|")
+			if !seen[key] {
+				seen[key] = true
+				rows = append(rows, record)
+			}
+		}
+	}
+
+	if header == nil {
+		return 0, nil
+	}
+
+	file, err := os.Create(fmt.Sprintf("%s/%s", outDir, name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write(header)
+	writer.WriteAll(rows)
+	return len(rows), writer.Error()
+}
+
+// mergeStats sums the statistics of the inputs, spanning the earliest start
+// and the latest end
+func mergeStats(outDir string, inputs []string) error {
+	var merged *types.ScanStats
+
+	for _, input := range inputs {
+		stats, err := ReadStats(input)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load stats of %s: %w", input, err)
+		}
+
+		if merged == nil {
+			merged = &types.ScanStats{
+				Mode:             stats.Mode,
+				StartTime:        stats.StartTime,
+				FilteredByTarget: make(map[string]int64),
+			}
+		}
+		if merged.Mode != stats.Mode {
+			merged.Mode = "mixed"
+		}
+		if !stats.StartTime.IsZero() && (merged.StartTime.IsZero() || stats.StartTime.Before(merged.StartTime)) {
+			merged.StartTime = stats.StartTime
+		}
+		if stats.EndTime.After(merged.EndTime) {
+			merged.EndTime = stats.EndTime
+		}
+
+		merged.TotalRequests += stats.TotalRequests
+		merged.SuccessCount += stats.SuccessCount
+		merged.ErrorCount += stats.ErrorCount
+		merged.TimeoutCount += stats.TimeoutCount
+		merged.FilteredCount += stats.FilteredCount
+		for target, count := range stats.FilteredByTarget {
+			merged.FilteredByTarget[target] += count
+		}
+		merged.SkippedCount += stats.SkippedCount
+		for host, reason := range stats.SkippedHosts {
+			if merged.SkippedHosts == nil {
+				merged.SkippedHosts = make(map[string]string)
+			}
+			merged.SkippedHosts[host] = reason
+		}
+		for target, count := range stats.DeadTargets {
+			if merged.DeadTargets == nil {
+				merged.DeadTargets = make(map[string]int64)
+			}
+			merged.DeadTargets[target] += count
+		}
+	}
+
+	if merged == nil {
+		return nil
+	}
+	return writeStats(outDir, *merged)
+}
+
+// appendLogs concatenates a log file of every input
+func appendLogs(outDir string, inputs []string, name string) error {
+	var out *os.File
+	for _, input := range inputs {
+		in, err := os.Open(fmt.Sprintf("%s/%s", input, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", name, err)
+		}
+
+		if out == nil {
+			out, err = os.Create(fmt.Sprintf("%s/%s", outDir, name))
+			if err != nil {
+				in.Close()
+				return fmt.Errorf("failed to create %s: %w", name, err)
+			}
+			defer out.Close()
+		}
+
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// sameDir reports whether two paths name the same directory
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
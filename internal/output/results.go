@@ -0,0 +1,160 @@
+package output
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// resultHeader lists the results.csv columns in the order they are written
+var resultHeader = []string{
+	"target", "word", "url", "status_code", "content_length", "response_time_ms", "title", "error", "host",
+	"tls_subject", "tls_issuer", "tls_sans", "tls_not_after", "protocol", "port", "hostname", "fingerprint", "response_file",
+	"method", "compare_status", "compare_length", "unprotected",
+}
+
+// resultRecord converts a result into a results.csv row
+func resultRecord(result types.Result) []string {
+	record := []string{
+		result.Target,
+		result.Word,
+		result.URL,
+		strconv.Itoa(result.StatusCode),
+		strconv.FormatInt(result.ContentLength, 10),
+		strconv.FormatInt(result.ResponseTime, 10),
+		result.Title,
+		result.Error,
+		result.Host,
+		result.TLSSubject,
+		result.TLSIssuer,
+		result.TLSSANs,
+		result.TLSNotAfter,
+		result.Protocol,
+		strconv.Itoa(result.Port),
+		result.Hostname,
+		result.Fingerprint,
+		result.ResponseFile,
+		result.Method,
+	}
+	if c := result.AuthCompare; c != nil {
+		record = append(record, strconv.Itoa(c.StatusCode), strconv.FormatInt(c.ContentLength, 10), strconv.FormatBool(c.Unprotected))
+	} else {
+		record = append(record, "", "", "")
+	}
+	return record
+}
+
+// ReadResults loads the results from a results.csv file. Columns are matched by
+// header name, so files written by older versions load with fewer fields set.
+func ReadResults(filename string) ([]types.Result, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // Allow variable number of fields
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+
+	var results []types.Result
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		result := types.Result{
+			Target:       field("target"),
+			Word:         field("word"),
+			URL:          field("url"),
+			Title:        field("title"),
+			Error:        field("error"),
+			Host:         field("host"),
+			TLSSubject:   field("tls_subject"),
+			TLSIssuer:    field("tls_issuer"),
+			TLSSANs:      field("tls_sans"),
+			TLSNotAfter:  field("tls_not_after"),
+			Protocol:     field("protocol"),
+			Hostname:     field("hostname"),
+			Fingerprint:  field("fingerprint"),
+			ResponseFile: field("response_file"),
+			Method:       field("method"),
+		}
+		result.StatusCode, _ = strconv.Atoi(field("status_code"))
+		result.ContentLength, _ = strconv.ParseInt(field("content_length"), 10, 64)
+		result.ResponseTime, _ = strconv.ParseInt(field("response_time_ms"), 10, 64)
+		result.Port, _ = strconv.Atoi(field("port"))
+		if field("compare_status") != "" {
+			result.AuthCompare = &types.AuthComparison{}
+			result.AuthCompare.StatusCode, _ = strconv.Atoi(field("compare_status"))
+			result.AuthCompare.ContentLength, _ = strconv.ParseInt(field("compare_length"), 10, 64)
+			result.AuthCompare.Unprotected, _ = strconv.ParseBool(field("unprotected"))
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// ReadResultsJSONL loads the results from a results.jsonl file
+func ReadResultsJSONL(filename string) ([]types.Result, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var results []types.Result
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var result types.Result
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return nil, fmt.Errorf("failed to parse %s line %d: %w", filename, line, err)
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
+
+// LoadResults loads a result set from an output directory, a results.csv or a
+// results.jsonl file
+func LoadResults(path string) ([]types.Result, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = fmt.Sprintf("%s/results.csv", path)
+	}
+	if strings.HasSuffix(path, ".jsonl") {
+		return ReadResultsJSONL(path)
+	}
+	return ReadResults(path)
+}
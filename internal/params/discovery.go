@@ -0,0 +1,267 @@
+package params
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// Parameter locations supported by the discoverer
+const (
+	LocationQuery = "query"
+	LocationJSON  = "json"
+)
+
+// signature summarizes a response for comparison against the baseline
+type signature struct {
+	statusCode int
+	size       int64
+	hash       [sha256.Size]byte
+	title      string
+	err        string
+}
+
+// baseline is the expected response for a URL without any candidate parameters
+type baseline struct {
+	signature
+	stableSize bool
+	stableBody bool
+}
+
+// Discoverer finds parameters that change an endpoint's response by sending
+// many candidates per request and bisecting the chunks that differ
+type Discoverer struct {
+	httpClient *http.Client
+	chunkSize  int
+	location   string
+
+	// OnRequest is called after every probe, used for statistics
+	OnRequest func(err error)
+}
+
+// NewDiscoverer creates a new parameter discoverer
+func NewDiscoverer(httpClient *http.Client, chunkSize int, location string) (*Discoverer, error) {
+	if location != LocationQuery && location != LocationJSON {
+		return nil, fmt.Errorf("unsupported parameter location: %s", location)
+	}
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+
+	return &Discoverer{
+		httpClient: httpClient,
+		chunkSize:  chunkSize,
+		location:   location,
+	}, nil
+}
+
+// Discover returns a result for each parameter in candidates that changes the
+// response of target compared to a request without it
+func (d *Discoverer) Discover(ctx context.Context, target string, candidates []string) ([]types.Result, error) {
+	value := randomToken()
+
+	base, err := d.baseline(ctx, target, value)
+	if err != nil {
+		return nil, err
+	}
+
+	// A parameter that cannot exist must not change the response, otherwise
+	// every chunk would look interesting
+	control := d.probe(ctx, target, []string{randomToken()}, value)
+	if !base.matches(control.signature) {
+		return nil, fmt.Errorf("response changes for unknown parameters, skipping")
+	}
+
+	var found []string
+	for start := 0; start < len(candidates); start += d.chunkSize {
+		end := start + d.chunkSize
+		if end > len(candidates) {
+			end = len(candidates)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		found = append(found, d.bisect(ctx, target, base, candidates[start:end], value)...)
+	}
+
+	// Re-request each parameter on its own so the saved result describes it
+	var results []types.Result
+	for _, param := range found {
+		results = append(results, d.probe(ctx, target, []string{param}, value).result)
+	}
+
+	return results, nil
+}
+
+// bisect narrows a chunk of parameters down to the ones that change the response
+func (d *Discoverer) bisect(ctx context.Context, target string, base *baseline, params []string, value string) []string {
+	if len(params) == 0 || ctx.Err() != nil {
+		return nil
+	}
+
+	resp := d.probe(ctx, target, params, value)
+	tooLarge := resp.statusCode == 413 || resp.statusCode == 414 || resp.statusCode == 431
+	if base.matches(resp.signature) {
+		return nil
+	}
+	if len(params) == 1 {
+		if tooLarge {
+			return nil
+		}
+		return params
+	}
+
+	mid := len(params) / 2
+	found := d.bisect(ctx, target, base, params[:mid], value)
+	return append(found, d.bisect(ctx, target, base, params[mid:], value)...)
+}
+
+// baseline requests target twice without parameters to learn its normal response
+func (d *Discoverer) baseline(ctx context.Context, target, value string) (*baseline, error) {
+	first := d.probe(ctx, target, nil, value)
+	if first.cause != nil {
+		return nil, fmt.Errorf("baseline request failed: %w", first.cause)
+	}
+	second := d.probe(ctx, target, nil, value)
+	if second.cause != nil {
+		return nil, fmt.Errorf("baseline request failed: %w", second.cause)
+	}
+	if first.statusCode != second.statusCode {
+		return nil, fmt.Errorf("unstable baseline status: %d vs %d", first.statusCode, second.statusCode)
+	}
+
+	return &baseline{
+		signature:  first.signature,
+		stableSize: first.size == second.size,
+		stableBody: first.hash == second.hash,
+	}, nil
+}
+
+// matches reports whether sig looks like the baseline response
+func (b *baseline) matches(sig signature) bool {
+	if sig.err != "" || b.statusCode != sig.statusCode || b.title != sig.title {
+		return false
+	}
+	// Dynamic pages can only be compared as precisely as they are stable
+	if b.stableBody {
+		return b.hash == sig.hash
+	}
+	return !b.stableSize || b.size == sig.size
+}
+
+// probeResult pairs a response signature with the result to save for it
+type probeResult struct {
+	signature
+	result types.Result
+	cause  error // why the request failed, if it did
+}
+
+// probe sends params with the given value and summarizes the response
+func (d *Discoverer) probe(ctx context.Context, target string, params []string, value string) probeResult {
+	start := time.Now()
+	requestURL, opts := d.BuildRequest(target, params, value)
+
+	pr := probeResult{
+		result: types.Result{
+			Target: target,
+			Word:   strings.Join(params, ","),
+			URL:    requestURL,
+			Method: opts.Method,
+		},
+	}
+	if pr.result.Method == "" {
+		pr.result.Method = "GET"
+	}
+
+	resp, err := d.httpClient.Do(ctx, requestURL, opts)
+	if d.OnRequest != nil {
+		d.OnRequest(err)
+	}
+	pr.result.ResponseTime = time.Since(start).Milliseconds()
+	if err != nil {
+		pr.err = err.Error()
+		pr.result.Error = pr.err
+		pr.result.Unreachable = http.IsConnectionError(err)
+		pr.cause = err
+		return pr
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024)) // Limit to 1MB
+	if err != nil {
+		pr.err = err.Error()
+		pr.result.Error = pr.err
+		pr.cause = err
+		return pr
+	}
+
+	// Reflected values would make every chunk look different, so strip them
+	content := strings.ReplaceAll(string(body), value, "")
+	pr.statusCode = resp.StatusCode
+	pr.size = int64(len(content))
+	pr.hash = sha256.Sum256([]byte(content))
+	pr.title = http.ExtractTitle(content)
+
+	pr.result.StatusCode = resp.StatusCode
+	pr.result.ContentLength = int64(len(body))
+	pr.result.Title = pr.title
+	pr.result.Fingerprint = http.Fingerprint(content, http.ExtractHost(target))
+	pr.result.Protocol = resp.Proto
+	pr.result.Port = http.URLPort(requestURL)
+	http.ApplyTLSInfo(&pr.result, resp.TLS)
+
+	return pr
+}
+
+// BuildRequest returns the URL and request options for sending params with value
+func (d *Discoverer) BuildRequest(target string, params []string, value string) (string, http.RequestOptions) {
+	if d.location == LocationJSON {
+		payload := make(map[string]string, len(params))
+		for _, param := range params {
+			payload[param] = value
+		}
+		body, _ := json.Marshal(payload)
+
+		return target, http.RequestOptions{
+			Method:  "POST",
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    body,
+		}
+	}
+
+	if len(params) == 0 {
+		return target, http.RequestOptions{}
+	}
+
+	query := make([]string, 0, len(params))
+	for _, param := range params {
+		query = append(query, url.QueryEscape(param)+"="+url.QueryEscape(value))
+	}
+
+	separator := "?"
+	if strings.Contains(target, "?") {
+		separator = "&"
+	}
+	return target + separator + strings.Join(query, "&"), http.RequestOptions{}
+}
+
+// randomToken returns a short random string used for parameter names and values
+func randomToken() string {
+	buf := make([]byte, 5)
+	rand.Read(buf)
+	return "as" + hex.EncodeToString(buf)
+}
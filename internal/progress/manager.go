@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"strconv"
 	"sync"
@@ -19,13 +20,15 @@ type Manager struct {
 	completed    sync.Map
 	fpTracker    *types.FalsePositiveTracker
 	fpMutex      sync.RWMutex
+	logger       *slog.Logger
 }
 
 // NewManager creates a new progress manager
-func NewManager(outDir string) *Manager {
+func NewManager(outDir string, logger *slog.Logger) *Manager {
 	return &Manager{
 		progressFile: fmt.Sprintf("%s/scan_progress.json", outDir),
 		fpTracker:    types.NewFalsePositiveTracker(),
+		logger:       logger,
 	}
 }
 
@@ -59,13 +62,20 @@ func (pm *Manager) SaveProgress() error {
 		return fmt.Errorf("no progress to save")
 	}
 
+	// Workers may still be tracking sizes when a paused scan checkpoints
+	pm.fpMutex.RLock()
 	pm.progress.FalsePositiveTracker = pm.fpTracker
 	data, err := json.MarshalIndent(pm.progress, "", "  ")
+	pm.fpMutex.RUnlock()
 	if err != nil {
 		return fmt.Errorf("failed to marshal progress: %w", err)
 	}
 
-	return os.WriteFile(pm.progressFile, data, 0644)
+	if err := os.WriteFile(pm.progressFile, data, 0644); err != nil {
+		return err
+	}
+	pm.logger.Debug("Saved progress", "file", pm.progressFile, "batch", pm.progress.LastBatch)
+	return nil
 }
 
 // LoadCompletedWork loads already completed target/word combinations
@@ -114,7 +124,7 @@ func (pm *Manager) LoadCompletedWork(outDir string) error {
 		}
 	}
 
-	fmt.Printf("Loaded %d completed work items from previous scan\n", count)
+	pm.logger.Info("Loaded completed work from previous scan", "items", count)
 	return nil
 }
 
@@ -0,0 +1,117 @@
+package report
+
+import (
+	"sort"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// maxExamples is the number of example URLs kept per cluster
+const maxExamples = 5
+
+// Cluster groups results that look like the same response across targets
+type Cluster struct {
+	StatusCode  int
+	SizeMin     int64
+	SizeMax     int64
+	Title       string
+	Fingerprint string
+	Count       int
+	Hosts       []string
+	Words       []string
+	Examples    []string
+}
+
+// clusterKey identifies the cluster a result belongs to
+type clusterKey struct {
+	statusCode  int
+	sizeBucket  int64
+	title       string
+	fingerprint string
+}
+
+// ClusterResults groups successful results by status code, size bucket, title
+// and body fingerprint, which is empty for results without one, like those
+// from older scans. Sizes fall into fixed-width buckets of bucketSize bytes
+// (0-99, 100-199 and so on for 100), and unknown sizes get a bucket of their
+// own. Clusters are sorted by the number of hosts they span, largest first.
+func ClusterResults(results []types.Result, bucketSize int64) []*Cluster {
+	if bucketSize < 1 {
+		bucketSize = 1
+	}
+
+	clusters := make(map[clusterKey]*Cluster)
+	hostSets := make(map[clusterKey]map[string]bool)
+	wordSets := make(map[clusterKey]map[string]bool)
+	var order []clusterKey
+
+	for _, result := range results {
+		if result.StatusCode == 0 || result.Error != "" {
+			continue
+		}
+
+		key := clusterKey{
+			statusCode:  result.StatusCode,
+			sizeBucket:  -1,
+			title:       result.Title,
+			fingerprint: result.Fingerprint,
+		}
+		if result.ContentLength >= 0 {
+			key.sizeBucket = result.ContentLength / bucketSize
+		}
+
+		cluster, ok := clusters[key]
+		if !ok {
+			cluster = &Cluster{
+				StatusCode:  result.StatusCode,
+				SizeMin:     result.ContentLength,
+				SizeMax:     result.ContentLength,
+				Title:       result.Title,
+				Fingerprint: result.Fingerprint,
+			}
+			clusters[key] = cluster
+			hostSets[key] = make(map[string]bool)
+			wordSets[key] = make(map[string]bool)
+			order = append(order, key)
+		}
+
+		cluster.Count++
+		cluster.SizeMin = min(cluster.SizeMin, result.ContentLength)
+		cluster.SizeMax = max(cluster.SizeMax, result.ContentLength)
+
+		if host := ResultHost(result); !hostSets[key][host] {
+			hostSets[key][host] = true
+			cluster.Hosts = append(cluster.Hosts, host)
+		}
+		if !wordSets[key][result.Word] {
+			wordSets[key][result.Word] = true
+			cluster.Words = append(cluster.Words, result.Word)
+		}
+		if len(cluster.Examples) < maxExamples {
+			cluster.Examples = append(cluster.Examples, result.URL)
+		}
+	}
+
+	sorted := make([]*Cluster, 0, len(order))
+	for _, key := range order {
+		sorted = append(sorted, clusters[key])
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if len(sorted[i].Hosts) != len(sorted[j].Hosts) {
+			return len(sorted[i].Hosts) > len(sorted[j].Hosts)
+		}
+		return sorted[i].Count > sorted[j].Count
+	})
+
+	return sorted
+}
+
+// ResultHost returns the host a result was served for: the Host header in
+// vhosts mode, otherwise the host of its URL
+func ResultHost(result types.Result) string {
+	if result.Host != "" {
+		return result.Host
+	}
+	return http.ExtractHost(result.URL)
+}
@@ -0,0 +1,42 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/internal/output"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// Data is everything a report is rendered from
+type Data struct {
+	OutDir    string
+	Generated time.Time
+	Stats     *types.ScanStats
+	Results   []types.Result
+	Clusters  []*Cluster
+}
+
+// Load reads the results and statistics of the scan in outDir and clusters
+// the results. A missing stats.json is not an error, since older scans and
+// scans still in progress may not have one yet.
+func Load(outDir string, sizeBucket int64) (*Data, error) {
+	results, err := output.ReadResults(fmt.Sprintf("%s/results.csv", outDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load results: %w", err)
+	}
+
+	stats, err := output.ReadStats(outDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &Data{
+		OutDir:    outDir,
+		Generated: time.Now(),
+		Stats:     stats,
+		Results:   results,
+		Clusters:  ClusterResults(results, sizeBucket),
+	}, nil
+}
@@ -0,0 +1,145 @@
+package report
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/internal/output"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// maxResponseDisplay limits how much of a stored response is embedded in the report
+const maxResponseDisplay = 64 * 1024
+
+//go:embed templates
+var templateFS embed.FS
+
+// htmlTemplate renders the full, self-contained HTML report
+var htmlTemplate = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"sizeRange":   sizeRange,
+	"statusClass": func(code int) int { return code / 100 },
+	"inc":         func(i int) int { return i + 1 },
+}).ParseFS(templateFS, "templates/report.html"))
+
+// htmlView is the data passed to the HTML template
+type htmlView struct {
+	OutDir       string
+	Generated    time.Time
+	Stats        *types.ScanStats
+	Clusters     []*Cluster
+	Targets      []targetView
+	StatusCodes  []statusView
+	Hits         int
+	ErrorResults int
+	CSS          template.CSS
+	JS           template.JS
+}
+
+// targetView holds the results of one target
+type targetView struct {
+	Target   string
+	Filtered int64
+	Results  []types.Result
+}
+
+// statusView is one bar of the status code distribution
+type statusView struct {
+	Code  int
+	Class int
+	Count int
+	Width int
+}
+
+// RenderHTML writes a self-contained HTML report with summary statistics, the
+// status code distribution, unique findings, and per-target result tables
+// including any stored responses
+func RenderHTML(w io.Writer, data *Data) error {
+	css, err := templateFS.ReadFile("templates/report.css")
+	if err != nil {
+		return err
+	}
+	js, err := templateFS.ReadFile("templates/report.js")
+	if err != nil {
+		return err
+	}
+
+	view := htmlView{
+		OutDir:    data.OutDir,
+		Generated: data.Generated,
+		Stats:     data.Stats,
+		Clusters:  data.Clusters,
+		CSS:       template.CSS(css),
+		JS:        template.JS(js),
+	}
+
+	byTarget := make(map[string]*targetView)
+	statusCounts := make(map[int]int)
+	for _, result := range data.Results {
+		tv, ok := byTarget[result.Target]
+		if !ok {
+			tv = &targetView{Target: result.Target}
+			if data.Stats != nil {
+				tv.Filtered = data.Stats.FilteredByTarget[result.Target]
+			}
+			byTarget[result.Target] = tv
+		}
+
+		if result.Error != "" {
+			view.ErrorResults++
+		} else if result.StatusCode > 0 {
+			view.Hits++
+			statusCounts[result.StatusCode]++
+		}
+
+		if result.ResponseFile != "" {
+			result.Response = readResponse(data.OutDir, result.ResponseFile)
+		}
+		tv.Results = append(tv.Results, result)
+	}
+
+	for _, tv := range byTarget {
+		view.Targets = append(view.Targets, *tv)
+	}
+	sort.Slice(view.Targets, func(i, j int) bool {
+		return view.Targets[i].Target < view.Targets[j].Target
+	})
+
+	maxCount := 0
+	for _, count := range statusCounts {
+		maxCount = max(maxCount, count)
+	}
+	for code, count := range statusCounts {
+		view.StatusCodes = append(view.StatusCodes, statusView{
+			Code:  code,
+			Class: code / 100,
+			Count: count,
+			Width: max(count*400/maxCount, 1),
+		})
+	}
+	sort.Slice(view.StatusCodes, func(i, j int) bool {
+		return view.StatusCodes[i].Code < view.StatusCodes[j].Code
+	})
+
+	return htmlTemplate.Execute(w, view)
+}
+
+// readResponse loads a stored response for display, truncating large ones
+func readResponse(outDir, name string) string {
+	if !output.ValidResponseName(name) {
+		return fmt.Sprintf("(invalid stored response name %q)", name)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, name))
+	if err != nil {
+		return fmt.Sprintf("(stored response unavailable: %v)", err)
+	}
+	if len(data) > maxResponseDisplay {
+		return string(data[:maxResponseDisplay]) + "\n... (truncated)"
+	}
+	return string(data)
+}
@@ -0,0 +1,90 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats supported by Render
+const (
+	FormatTerminal = "terminal"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// Render writes the report to w in the given format
+func Render(w io.Writer, data *Data, format string) error {
+	switch format {
+	case FormatTerminal:
+		return RenderTerminal(w, data.Clusters)
+	case FormatMarkdown:
+		return RenderMarkdown(w, data.Clusters)
+	case FormatHTML:
+		return RenderHTML(w, data)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// RenderTerminal writes the clusters as an aligned text table
+func RenderTerminal(w io.Writer, clusters []*Cluster) error {
+	fmt.Fprintf(w, "%d unique findings\n\n", len(clusters))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSTATUS\tSIZE\tTITLE\tHOSTS\tHITS\tEXAMPLE")
+	for i, cluster := range clusters {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%d\t%d\t%s\n",
+			i+1,
+			cluster.StatusCode,
+			sizeRange(cluster),
+			truncate(cluster.Title, 40),
+			len(cluster.Hosts),
+			cluster.Count,
+			cluster.Examples[0],
+		)
+	}
+	return tw.Flush()
+}
+
+// RenderMarkdown writes the clusters as a markdown table
+func RenderMarkdown(w io.Writer, clusters []*Cluster) error {
+	fmt.Fprintf(w, "# API Spray Report\n\n%d unique findings\n\n", len(clusters))
+	fmt.Fprintln(w, "| # | Status | Size | Title | Hosts | Hits | Example |")
+	fmt.Fprintln(w, "|---|--------|------|-------|-------|------|---------|")
+	for i, cluster := range clusters {
+		fmt.Fprintf(w, "| %d | %d | %s | %s | %d | %d | %s |\n",
+			i+1,
+			cluster.StatusCode,
+			sizeRange(cluster),
+			escapeMarkdown(cluster.Title),
+			len(cluster.Hosts),
+			cluster.Count,
+			escapeMarkdown(cluster.Examples[0]),
+		)
+	}
+	return nil
+}
+
+// sizeRange formats the sizes seen in a cluster
+func sizeRange(cluster *Cluster) string {
+	if cluster.SizeMin == cluster.SizeMax {
+		return fmt.Sprintf("%d", cluster.SizeMin)
+	}
+	return fmt.Sprintf("%d-%d", cluster.SizeMin, cluster.SizeMax)
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// escapeMarkdown escapes characters that would break a markdown table cell
+func escapeMarkdown(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
@@ -0,0 +1,7 @@
+// Filters the result rows of every target table by the text in the filter box
+document.getElementById("filter").addEventListener("input", function (e) {
+  var needle = e.target.value.toLowerCase();
+  document.querySelectorAll("tr.result").forEach(function (row) {
+    row.style.display = row.textContent.toLowerCase().indexOf(needle) >= 0 ? "" : "none";
+  });
+});
@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+)
+
+// StopError is returned by Run when the scan stopped early because it used up
+// a budget, or finished with work skipped for some targets. Progress is saved,
+// so the scan can be resumed.
+type StopError struct {
+	Reason string
+}
+
+func (e *StopError) Error() string {
+	return "scan stopped: " + e.Reason
+}
+
+// hostUsage counts the requests sent to a host in this run
+type hostUsage struct {
+	requests int64
+	errors   int64
+}
+
+// stop ends the run because a budget was used up
+func (s *Scanner) stop(reason string) {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+
+	if s.stopReason != "" || s.cancel == nil {
+		return
+	}
+	s.stopReason = reason
+	s.logger.Warn("Budget reached, stopping", "reason", reason)
+	s.cancel(&StopError{Reason: reason})
+}
+
+// StopReason returns why the scan stopped early, if it did
+func (s *Scanner) StopReason() string {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+	return s.stopReason
+}
+
+// countRequest counts a request sent to url against the budgets. It is
+// called by the HTTP clients for every request, so retries, the HTTP fallback,
+// bypass probes and -auth-diff requests all count. Only timeouts and
+// connection errors count as failed: a TLS error while probing the scheme or
+// a host that doesn't exist says nothing about a host's health.
+func (s *Scanner) countRequest(url string, err error) {
+	if s.config.MaxRequests > 0 && atomic.AddInt64(&s.runRequests, 1) >= s.config.MaxRequests {
+		s.stop(fmt.Sprintf("max-requests %d reached", s.config.MaxRequests))
+	}
+	s.recordHost(http.ExtractHost(url), http.IsConnectionError(err))
+}
+
+// recordHost counts a request to host against -max-requests-per-host and
+// -max-host-errors, skipping the host once either is used up
+func (s *Scanner) recordHost(host string, failed bool) {
+	if s.config.MaxRequestsPerHost <= 0 && s.config.MaxHostErrors <= 0 {
+		return
+	}
+
+	s.budgetMutex.Lock()
+	usage := s.usage[host]
+	if usage == nil {
+		usage = &hostUsage{}
+		s.usage[host] = usage
+	}
+	usage.requests++
+	if failed {
+		usage.errors++
+	}
+	requests, errors := usage.requests, usage.errors
+	s.budgetMutex.Unlock()
+
+	switch {
+	case s.config.MaxRequestsPerHost > 0 && requests >= s.config.MaxRequestsPerHost:
+		s.skipHost(host, fmt.Sprintf("max-requests-per-host %d reached", s.config.MaxRequestsPerHost))
+	case s.config.MaxHostErrors > 0 && errors >= s.config.MaxHostErrors:
+		s.skipHost(host, fmt.Sprintf("max-host-errors %d reached", s.config.MaxHostErrors))
+	}
+}
+
+// skipHost leaves the rest of the work for a host undone
+func (s *Scanner) skipHost(host, reason string) {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+
+	if _, ok := s.skipped[host]; ok {
+		return
+	}
+	s.skipped[host] = reason
+	s.logger.Warn("Skipping host", "host", host, "reason", reason)
+}
+
+// isSkipped reports whether the remaining work for target's host is skipped
+func (s *Scanner) isSkipped(target string) bool {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+	_, ok := s.skipped[http.ExtractHost(target)]
+	return ok
+}
+
+// finishPending ends a run that is through its batches but skipped some of
+// the work, keeping the progress so that a resume retries it
+func (s *Scanner) finishPending() error {
+	pending := make(map[string]bool)
+	for target := range s.pendingSnapshot() {
+		pending[target] = true
+	}
+	// Certificate hostnames left over by runSANCandidates were skipped too
+	s.sanMutex.Lock()
+	if progress := s.progressMgr.GetProgress(); progress != nil {
+		for target := range progress.SANCandidates {
+			pending[target] = true
+		}
+	}
+	s.sanMutex.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	reason := "work skipped, resume to retry it"
+	s.budgetMutex.Lock()
+	s.stopReason = reason
+	s.budgetMutex.Unlock()
+
+	if err := s.SaveProgress(); err != nil {
+		s.logger.Warn("Failed to save progress", "error", err)
+	}
+	s.saveFinalStats()
+	s.logger.Warn("Scan finished with skipped work, progress saved", "targets", len(pending), "outdir", s.config.OutDir)
+	return &StopError{Reason: reason}
+}
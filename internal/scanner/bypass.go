@@ -0,0 +1,119 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// maxBypassCandidates bounds the protected paths probed per target, so
+// targets that answer 403 to everything don't multiply the scan
+const maxBypassCandidates = 25
+
+// collectBypass queues a 401 or 403 response for bypass probing
+func (s *Scanner) collectBypass(target string, result types.Result) {
+	if result.StatusCode != 401 && result.StatusCode != 403 {
+		return
+	}
+
+	s.bypassMutex.Lock()
+	defer s.bypassMutex.Unlock()
+
+	progress := s.progressMgr.GetProgress()
+	if s.bypassSeen == nil {
+		// Count what a resumed scan had queued already
+		s.bypassSeen = make(map[string]bool)
+		s.bypassQueued = make(map[string]int)
+		for _, candidate := range progress.BypassCandidates {
+			s.bypassSeen[candidate.Target+"|"+candidate.Word] = true
+			s.bypassQueued[candidate.Target]++
+		}
+	}
+
+	key := target + "|" + result.Word
+	if s.bypassSeen[key] {
+		return
+	}
+	if s.bypassQueued[target] == maxBypassCandidates {
+		s.logger.Debug("Too many protected paths, skipping bypass probing for the rest", "target", target, "limit", maxBypassCandidates)
+	}
+	if s.bypassQueued[target] >= maxBypassCandidates {
+		s.bypassQueued[target]++
+		return
+	}
+
+	s.bypassSeen[key] = true
+	s.bypassQueued[target]++
+	progress.BypassCandidates = append(progress.BypassCandidates, types.BypassCandidate{
+		Target:        target,
+		Word:          result.Word,
+		URL:           result.URL,
+		Host:          result.Host,
+		StatusCode:    result.StatusCode,
+		ContentLength: result.ContentLength,
+	})
+}
+
+// runBypass probes the 401 and 403 responses collected during the scan with
+// bypass variants. Candidates left when ctx is cancelled stay in the progress
+// file for a resume.
+func (s *Scanner) runBypass(ctx context.Context) error {
+	progress := s.progressMgr.GetProgress()
+
+	s.bypassMutex.Lock()
+	candidates := append([]types.BypassCandidate(nil), progress.BypassCandidates...)
+	s.bypassMutex.Unlock()
+
+	if len(candidates) == 0 {
+		return nil
+	}
+	s.logger.Info("Probing protected paths for bypasses", "candidates", len(candidates))
+
+	done := make([]bool, len(candidates))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(s.config.Threads, len(candidates)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range work {
+				s.waitForWindow(ctx)
+				s.throttle(ctx)
+				if ctx.Err() != nil {
+					continue
+				}
+				bypasses := http.TestBypass(ctx, s.httpClient, candidates[index])
+				if ctx.Err() != nil {
+					continue
+				}
+				for _, bypass := range bypasses {
+					if err := s.outputMgr.WriteBypass(bypass); err != nil {
+						s.logger.Error("Failed to write bypass result", "target", bypass.Target, "url", bypass.URL, "error", err)
+					}
+				}
+				done[index] = true
+			}
+		}()
+	}
+
+	for i := range candidates {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	// Keep the candidates that weren't probed
+	s.bypassMutex.Lock()
+	var remaining []types.BypassCandidate
+	for i, candidate := range candidates {
+		if !done[i] {
+			remaining = append(remaining, candidate)
+		}
+	}
+	progress.BypassCandidates = remaining
+	s.bypassMutex.Unlock()
+
+	return ctx.Err()
+}
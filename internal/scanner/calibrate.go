@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/internal/targets"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// Calibration records how a target answers for words that don't exist
+type Calibration struct {
+	Target        string `json:"target"`
+	URL           string `json:"url"`
+	Host          string `json:"host,omitempty"`
+	StatusCode    int    `json:"status_code"`
+	ContentLength int64  `json:"content_length"`
+	Title         string `json:"title,omitempty"`
+	// Stable is set when every probe got the same status code and size
+	Stable bool `json:"stable"`
+	// Wildcard is set when every probe matched, so every word would be a hit
+	Wildcard bool   `json:"wildcard"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Calibrate requests random words from every target, without running a scan
+// or writing to the output directory
+func (s *Scanner) Calibrate(ctx context.Context, targetList *targets.List, probes int) []Calibration {
+	calibrations := make([]Calibration, targetList.Len())
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(s.config.Threads, targetList.Len()); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range work {
+				calibrations[index] = s.calibrate(ctx, targetList.At(index), probes)
+			}
+		}()
+	}
+
+	for i := 0; i < targetList.Len(); i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return calibrations
+}
+
+// calibrate probes a single target with random words
+func (s *Scanner) calibrate(ctx context.Context, target string, probes int) Calibration {
+	calibration := Calibration{Target: target, Stable: true, Wildcard: true}
+	mode := s.config.GetMode()
+
+	for i := 0; i < probes; i++ {
+		word := http.RandomWord()
+		url := http.GenerateURL(target, word, mode)
+
+		var result types.Result
+		var size int64
+		if mode == types.ModeVHosts {
+			host := http.RandomVHost(http.VHostDomain(target, s.config.VHostDomain))
+			result, size = http.TestVHost(ctx, s.httpClient, target, word, url, host, s.config.StatusCodes, s.config.DisableHTTP)
+		} else {
+			result = http.TestURL(ctx, s.httpClient, nil, target, word, url, s.config.StatusCodes, s.config.DisableHTTP)
+			size = result.ContentLength
+		}
+
+		if result.Error != "" {
+			s.logger.Debug("Calibration request failed", "target", target, "word", word, "url", result.URL, "error", result.Error)
+			calibration.URL = result.URL
+			calibration.Error = result.Error
+			calibration.Stable = false
+			calibration.Wildcard = false
+			return calibration
+		}
+
+		if i == 0 {
+			calibration.URL = result.URL
+			calibration.Host = result.Host
+			calibration.StatusCode = result.StatusCode
+			calibration.ContentLength = size
+			calibration.Title = result.Title
+		} else if result.StatusCode != calibration.StatusCode || size != calibration.ContentLength {
+			calibration.Stable = false
+		}
+		if !s.matches(result) {
+			calibration.Wildcard = false
+		}
+	}
+
+	return calibration
+}
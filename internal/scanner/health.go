@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// targetHealth tracks whether a target still answers
+type targetHealth struct {
+	failures  int
+	dead      bool
+	nextCheck time.Time
+	checking  bool
+}
+
+// tracksHealth reports whether the requests for target all go to one host.
+// In subdomains mode, and for wildcards in the host name, every word is a
+// different host, so one failing says nothing about the others.
+func (s *Scanner) tracksHealth(target string) bool {
+	return s.config.DeadAfter > 0 && s.config.GetMode() != types.ModeSubdomains &&
+		!strings.Contains(http.ExtractHost(target), "*")
+}
+
+// isAlive reports whether a job for target should be sent. Jobs for a dead
+// target are skipped while it is checked again every -dead-recheck.
+func (s *Scanner) isAlive(ctx context.Context, target string) bool {
+	if !s.tracksHealth(target) {
+		return true
+	}
+
+	s.healthMutex.Lock()
+	defer s.healthMutex.Unlock()
+
+	health := s.health[target]
+	if health == nil || !health.dead {
+		return true
+	}
+	if !health.checking {
+		health.checking = true
+		go s.recheckDead(ctx, target)
+	}
+
+	s.deadSkipped[target]++
+	return false
+}
+
+// recheckDead requests a dead target every -dead-recheck until it answers
+// again, so it comes back even when no more of its jobs are queued by then
+func (s *Scanner) recheckDead(ctx context.Context, target string) {
+	defer func() {
+		s.healthMutex.Lock()
+		s.health[target].checking = false
+		s.healthMutex.Unlock()
+	}()
+
+	url := http.GenerateURL(target, "", s.config.GetMode())
+	for {
+		s.healthMutex.Lock()
+		health := s.health[target]
+		dead, wait := health.dead, time.Until(health.nextCheck)
+		s.healthMutex.Unlock()
+		if !dead {
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.throttle(ctx)
+		s.logger.Debug("Checking dead target", "target", target)
+		result := http.TestURL(ctx, s.httpClient, nil, target, "", url, s.config.StatusCodes, s.config.DisableHTTP)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.healthMutex.Lock()
+		if !result.Unreachable && health.dead {
+			s.logger.Info("Target answers again, resuming", "target", target, "status", result.StatusCode)
+			health.failures = 0
+			health.dead = false
+		} else if health.dead {
+			health.nextCheck = time.Now().Add(s.config.DeadRecheck)
+			s.logger.Debug("Dead target still not answering", "target", target, "error", result.Error)
+		}
+		s.healthMutex.Unlock()
+	}
+}
+
+// recordHealth counts consecutive requests to target that timed out or could
+// not connect, marking it dead after -dead-after of them and alive again once
+// it answers. Other errors, like a failed TLS handshake, mean it answered.
+func (s *Scanner) recordHealth(target string, result types.Result) {
+	if !s.tracksHealth(target) {
+		return
+	}
+
+	s.healthMutex.Lock()
+	defer s.healthMutex.Unlock()
+
+	health := s.health[target]
+	if health == nil {
+		health = &targetHealth{}
+		s.health[target] = health
+	}
+
+	if !result.Unreachable {
+		if health.dead {
+			s.logger.Info("Target answers again, resuming", "target", target, "status", result.StatusCode)
+		}
+		health.failures = 0
+		health.dead = false
+		return
+	}
+
+	health.failures++
+	if health.dead {
+		// Requests sent before it was marked dead; recheckDead decides when it is back
+		return
+	}
+	if health.failures >= s.config.DeadAfter {
+		health.dead = true
+		health.nextCheck = time.Now().Add(s.config.DeadRecheck)
+		s.logger.Warn("Target not answering, skipping its words", "target", target,
+			"failures", health.failures, "error", result.Error, "recheck", s.config.DeadRecheck.String())
+	}
+}
@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/davidwkirsch/api_spray/internal/targets"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// hostnameFor returns a readable hostname for an IP target, using reverse DNS
+// first and the certificate on the result second. Non-IP targets return "".
+func (s *Scanner) hostnameFor(ctx context.Context, target string, result types.Result) string {
+	_, host, _, _ := targets.SplitTarget(target)
+	if net.ParseIP(host) == nil {
+		return ""
+	}
+
+	value, ok := s.hostnames.Load(host)
+	if !ok {
+		name := ""
+		if names, err := net.DefaultResolver.LookupAddr(ctx, host); err == nil && len(names) > 0 {
+			name = strings.TrimSuffix(names[0], ".")
+		}
+		value, _ = s.hostnames.LoadOrStore(host, name)
+	}
+	if name := value.(string); name != "" {
+		return name
+	}
+
+	for _, san := range strings.Split(result.TLSSANs, ";") {
+		if san != "" && !strings.HasPrefix(san, "*.") {
+			return san
+		}
+	}
+	return result.TLSSubject
+}
@@ -0,0 +1,194 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/internal/params"
+	"github.com/davidwkirsch/api_spray/internal/targets"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// runParams discovers parameters for each target URL. Each batch is a group of
+// URLs that are processed concurrently, with every URL bisected on its own.
+func (s *Scanner) runParams(ctx context.Context, targetList *targets.List, paramList []string) error {
+	discoverer, err := params.NewDiscoverer(s.httpClient, s.config.ParamsChunk, s.config.ParamsIn)
+	if err != nil {
+		return err
+	}
+	discoverer.OnRequest = func(err error) {
+		s.UpdateStats("total", 1)
+		if err != nil {
+			if strings.Contains(err.Error(), "timeout") {
+				s.UpdateStats("timeout", 1)
+			} else {
+				s.UpdateStats("error", 1)
+			}
+		}
+	}
+
+	totalBatches := (targetList.Len() + s.config.Batch - 1) / s.config.Batch
+	progress := s.progressMgr.GetProgress()
+	if progress == nil {
+		progress = &types.Progress{
+			StartTime:            time.Now(),
+			FalsePositiveTracker: types.NewFalsePositiveTracker(),
+		}
+		s.progressMgr.SetProgress(progress)
+	}
+	progress.TotalBatches = totalBatches
+	progress.TotalWork = targetList.Len()
+
+	s.logger.Info("Parameter discovery", "urls", targetList.Len(), "parameters", len(paramList),
+		"per_request", s.config.ParamsChunk, "in", s.config.ParamsIn)
+
+	// Batches before the last one done are only redone for the URLs whose
+	// discovery was skipped in them
+	s.loadPending(progress.Pending)
+	retryEnd := progress.LastBatch
+	startBatch := s.firstPending(progress.LastBatch)
+
+	atomic.StoreInt64(&s.stats.completedCount, int64(progress.LastBatch*s.config.Batch))
+	atomic.StoreInt64(&s.stats.lastBatch, int64(progress.LastBatch))
+	if s.config.MetricsAddr != "" {
+		if err := s.startMetrics(); err != nil {
+			return err
+		}
+		defer s.metrics.Stop()
+	}
+	if s.config.Dashboard {
+		s.startDashboard()
+		defer s.stopDashboard()
+	}
+
+	s.logger.Info("Starting from batch", "batch", startBatch+1, "batches", totalBatches)
+	for batchNum := startBatch; batchNum < totalBatches; batchNum = s.nextBatch(batchNum, retryEnd) {
+		startIdx := batchNum * s.config.Batch
+		endIdx := startIdx + s.config.Batch
+		if endIdx > targetList.Len() {
+			endIdx = targetList.Len()
+		}
+
+		s.logger.Info("Batch started", "batch", batchNum+1, "batches", totalBatches,
+			"first_url", startIdx+1, "last_url", endIdx)
+		atomic.StoreInt64(&s.stats.currentBatch, int64(batchNum+1))
+
+		batchTargets := targetList.Slice(startIdx, endIdx)
+		if batchNum < retryEnd {
+			batchTargets = s.pendingIn(batchTargets, batchNum)
+		}
+
+		s.processParamsBatch(ctx, discoverer, batchTargets, paramList)
+		if ctx.Err() != nil {
+			// The batch is redone on resume
+			s.saveInterrupted()
+			return ctx.Err()
+		}
+
+		s.settleUndone(batchNum, retryEnd)
+		progress.LastBatch = max(progress.LastBatch, batchNum+1)
+		progress.CompletedCount = max(progress.CompletedCount, endIdx)
+		atomic.StoreInt64(&s.stats.lastBatch, int64(progress.LastBatch))
+		if err := s.SaveProgress(); err != nil {
+			s.logger.Warn("Failed to save progress", "error", err)
+		}
+
+		s.logBatchStats(batchNum + 1)
+	}
+
+	if err := s.finishPending(); err != nil {
+		return err
+	}
+
+	s.saveFinalStats()
+	s.progressMgr.CleanupProgressFile()
+	s.logger.Info("Scan completed successfully")
+
+	return nil
+}
+
+// processParamsBatch runs parameter discovery for a batch of URLs
+func (s *Scanner) processParamsBatch(ctx context.Context, discoverer *params.Discoverer, targetList *targets.List, paramList []string) {
+	work := make(chan string)
+	var wg sync.WaitGroup
+
+	workers := s.config.Threads
+	if workers > targetList.Len() {
+		workers = targetList.Len()
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range work {
+				atomic.AddInt64(&s.stats.queued, -1)
+				s.waitForWindow(ctx)
+				s.throttle(ctx)
+				if ctx.Err() != nil {
+					continue
+				}
+				if s.isSkipped(target) {
+					s.UpdateStats("skipped", 1)
+					s.leaveUndone(target)
+					atomic.AddInt64(&s.stats.completedCount, 1)
+					continue
+				}
+				if !s.isAlive(ctx, target) {
+					s.UpdateStats("skipped", 1)
+					s.leaveUndone(target)
+					atomic.AddInt64(&s.stats.completedCount, 1)
+					continue
+				}
+
+				url := target
+				if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+					url = "https://" + url
+				}
+
+				results, err := discoverer.Discover(ctx, url, paramList)
+				atomic.AddInt64(&s.stats.completedCount, 1)
+				if ctx.Err() != nil {
+					continue
+				}
+				var health types.Result
+				if err != nil {
+					health.Error = err.Error()
+					health.Unreachable = http.IsConnectionError(err)
+				}
+				s.recordHealth(target, health)
+				if err != nil {
+					s.logger.Warn("Parameter discovery failed", "target", target, "url", url, "error", err)
+					s.outputMgr.WriteError(types.Result{Target: target, URL: url, Error: err.Error()})
+					continue
+				}
+
+				for _, result := range results {
+					result.Target = target
+					if s.config.ResolveIPs {
+						result.Hostname = s.hostnameFor(ctx, target, result)
+					}
+					s.UpdateStats("success", 1)
+					s.writeResult(result)
+					if s.dashboard != nil {
+						s.dashboard.RecordResult(result, true)
+					}
+					replayURL, opts := discoverer.BuildRequest(url, []string{result.Word}, "1")
+					s.replay(ctx, replayURL, opts)
+				}
+			}
+		}()
+	}
+
+	for target := range targetList.All() {
+		atomic.AddInt64(&s.stats.queued, 1)
+		work <- target
+	}
+	close(work)
+
+	wg.Wait()
+}
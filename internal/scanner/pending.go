@@ -0,0 +1,103 @@
+package scanner
+
+import (
+	"maps"
+
+	"github.com/davidwkirsch/api_spray/internal/targets"
+)
+
+// leaveUndone records that some of target's work in the current batch was
+// skipped, so that it stays pending until a later run does it
+func (s *Scanner) leaveUndone(target string) {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+	s.undone[target] = true
+}
+
+// loadPending restores the targets a previous run left work undone for, by
+// the first batch holding it
+func (s *Scanner) loadPending(pending map[string]int) {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+	s.pending = maps.Clone(pending)
+	if s.pending == nil {
+		s.pending = make(map[string]int)
+	}
+}
+
+// pendingSnapshot returns the targets with work left undone, by the first
+// batch holding it
+func (s *Scanner) pendingSnapshot() map[string]int {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+	if len(s.pending) == 0 {
+		return nil
+	}
+	return maps.Clone(s.pending)
+}
+
+// firstPending returns the first batch with work left undone, or end if there
+// is none before it
+func (s *Scanner) firstPending(end int) int {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+	first := end
+	for _, batch := range s.pending {
+		first = min(first, batch)
+	}
+	return first
+}
+
+// nextBatch returns the batch to do after batch, skipping those before
+// retryEnd that have no pending work
+func (s *Scanner) nextBatch(batch, retryEnd int) int {
+	return max(batch+1, s.firstPending(retryEnd))
+}
+
+// pendingIn returns the targets of list that still have work undone in batch
+func (s *Scanner) pendingIn(list *targets.List, batch int) *targets.List {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+
+	var lines []string
+	for target := range list.All() {
+		if from, ok := s.pending[target]; ok && from <= batch {
+			lines = append(lines, target)
+		}
+	}
+	pending, _ := targets.NewList(lines)
+	return pending
+}
+
+// settleUndone updates the pending work once batch is done. Targets with work
+// skipped in it become pending from it; targets that were pending from it and
+// got all of it done move on to the next batch, until retryEnd, the batch the
+// run resumed from, after which every batch is done for all targets.
+func (s *Scanner) settleUndone(batch, retryEnd int) {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+
+	for target, from := range s.pending {
+		if from == batch && !s.undone[target] {
+			if batch+1 < retryEnd {
+				s.pending[target] = batch + 1
+			} else {
+				delete(s.pending, target)
+			}
+		}
+	}
+	for target := range s.undone {
+		if _, ok := s.pending[target]; !ok {
+			s.pending[target] = batch
+		}
+	}
+	clear(s.undone)
+}
+
+// clearUndone forgets the work skipped outside of the batches, which is kept
+// pending elsewhere
+func (s *Scanner) clearUndone() {
+	s.budgetMutex.Lock()
+	defer s.budgetMutex.Unlock()
+	clear(s.undone)
+}
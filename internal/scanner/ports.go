@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+
+	"github.com/davidwkirsch/api_spray/internal/targets"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// expandPorts rewrites each target for every port in -ports. Ports are checked
+// for TCP and TLS first, so only live origins are sprayed.
+func (s *Scanner) expandPorts(ctx context.Context, targetList *targets.List) *targets.List {
+	// Subdomain hosts aren't known until words are applied, and direct dials say
+	// nothing about what is reachable through a proxy, so skip the pre-check
+	if s.config.GetMode() == types.ModeSubdomains || s.config.Proxy != "" {
+		s.logger.Info("Port expansion without pre-check", "targets", targetList.Len(), "ports", len(s.config.Ports))
+		return targetList.WithPorts(s.config.Ports)
+	}
+
+	hosts := func(yield func(string) bool) {
+		for target := range targetList.All() {
+			_, host, _, _ := targets.SplitTarget(target)
+			if !strings.Contains(host, "*") && !yield(host) {
+				return
+			}
+		}
+	}
+
+	s.logger.Info("Port pre-check started", "targets", targetList.Len(), "ports", len(s.config.Ports))
+	live := targets.ProbeOrigins(ctx, hosts, s.config.Ports, s.config.Timeout, s.config.Threads)
+
+	// Only live origins are kept, so this holds no more targets than answered
+	var expanded []string
+	schemes := make(map[string]string)
+	for target := range targetList.All() {
+		scheme, host, _, _ := targets.SplitTarget(target)
+		for _, port := range s.config.Ports {
+			// Wildcard hosts aren't known until words are applied, like subdomains
+			if strings.Contains(host, "*") {
+				expanded = append(expanded, targets.WithPort(target, scheme, port))
+				continue
+			}
+
+			origin, ok := live[targets.Origin{Host: host, Port: port}.Key()]
+			if !ok {
+				continue
+			}
+			if origin.Scheme == "http" && s.config.DisableHTTP {
+				continue
+			}
+
+			// Only TLS is trusted from the pre-check; a failed handshake may just
+			// mean the server wants a client certificate, so HTTP is still learned
+			// the usual way
+			if origin.Scheme == "https" {
+				schemes[strings.ToLower(origin.Key())] = "https"
+			}
+			expanded = append(expanded, targets.WithPort(target, origin.Scheme, port))
+		}
+	}
+	s.httpClient.LoadSchemes(schemes)
+
+	s.logger.Info("Port pre-check completed", "live_origins", len(live), "targets", len(expanded))
+
+	// Port-expanded targets are never ranges
+	list, _ := targets.NewList(expanded)
+	return list
+}
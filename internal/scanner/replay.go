@@ -0,0 +1,24 @@
+package scanner
+
+import (
+	"context"
+	"io"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+)
+
+// replay re-sends a saved hit through the replay proxy, so that only hits end
+// up in the proxy's history rather than every request of the scan
+func (s *Scanner) replay(ctx context.Context, url string, opts http.RequestOptions) {
+	if s.replayClient == nil {
+		return
+	}
+
+	resp, err := s.replayClient.Do(ctx, url, opts)
+	if err != nil {
+		s.logger.Warn("Failed to replay hit", "url", url, "error", err)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
@@ -0,0 +1,121 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/internal/targets"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// maxSANRounds bounds how often hosts found in certificates of hosts that were
+// themselves found in certificates are followed
+const maxSANRounds = 3
+
+// collectSANs queues hostnames from a result's certificate that fall under the
+// target domain and haven't been tested yet
+func (s *Scanner) collectSANs(target string, result types.Result) {
+	if result.TLSSANs == "" {
+		return
+	}
+
+	domain := http.ExtractHost(target)
+	hosts := http.SANHostnames(result, domain)
+	if len(hosts) == 0 {
+		return
+	}
+
+	s.sanMutex.Lock()
+	defer s.sanMutex.Unlock()
+
+	progress := s.progressMgr.GetProgress()
+	if progress.SANCandidates == nil {
+		progress.SANCandidates = make(map[string][]string)
+	}
+
+	for _, host := range hosts {
+		label := strings.TrimSuffix(host, "."+domain)
+		key := target + "|" + label
+		if s.words[label] || s.sanSeen[key] || s.progressMgr.IsCompleted(target, label) {
+			continue
+		}
+		s.sanSeen[key] = true
+		progress.SANCandidates[target] = append(progress.SANCandidates[target], label)
+	}
+}
+
+// runSANCandidates tests the hostnames collected from certificates against their
+// targets, repeating while new hostnames keep turning up. Hostnames skipped
+// for a dead or over-budget target stay candidates for a resume to retry.
+func (s *Scanner) runSANCandidates(ctx context.Context) error {
+	progress := s.progressMgr.GetProgress()
+
+	// Skipped hostnames are kept at the start of their target's candidates
+	// and not tried again in this run
+	left := make(map[string]int)
+
+	for round := 0; round < maxSANRounds; round++ {
+		s.sanMutex.Lock()
+		pending := make(map[string][]string, len(progress.SANCandidates))
+		for target, labels := range progress.SANCandidates {
+			if len(labels) > left[target] {
+				pending[target] = slices.Clone(labels[left[target]:])
+			}
+		}
+		s.sanMutex.Unlock()
+
+		if len(pending) == 0 {
+			break
+		}
+
+		for target, labels := range pending {
+			s.logger.Info("Testing TLS certificate hosts", "target", target, "candidates", len(labels))
+
+			targetList, _ := targets.NewList([]string{target})
+			if err := s.processBatch(ctx, targetList, labels); err != nil {
+				return fmt.Errorf("error processing certificate hosts for %s: %w", target, err)
+			}
+			s.clearUndone()
+
+			// Drop what was processed, keeping what was skipped and anything
+			// queued in the meantime
+			s.sanMutex.Lock()
+			candidates := progress.SANCandidates[target]
+			kept := slices.Clone(candidates[:left[target]])
+			for _, label := range labels {
+				if !s.progressMgr.IsCompleted(target, label) {
+					kept = append(kept, label)
+				}
+			}
+			queued := candidates[left[target]+len(labels):]
+			left[target] = len(kept)
+			kept = append(kept, queued...)
+			if len(kept) == 0 {
+				delete(progress.SANCandidates, target)
+			} else {
+				progress.SANCandidates[target] = kept
+			}
+			s.sanMutex.Unlock()
+
+			if err := s.SaveProgress(); err != nil {
+				s.logger.Warn("Failed to save progress", "error", err)
+			}
+		}
+	}
+
+	// Hostnames still queued after the last round are not followed
+	s.sanMutex.Lock()
+	for target, labels := range progress.SANCandidates {
+		if left[target] == 0 {
+			delete(progress.SANCandidates, target)
+		} else {
+			progress.SANCandidates[target] = labels[:left[target]]
+		}
+	}
+	s.sanMutex.Unlock()
+
+	return nil
+}
@@ -3,25 +3,80 @@ package scanner
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math"
+	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/davidwkirsch/api_spray/internal/dashboard"
 	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/internal/logging"
+	"github.com/davidwkirsch/api_spray/internal/metrics"
 	"github.com/davidwkirsch/api_spray/internal/output"
 	"github.com/davidwkirsch/api_spray/internal/progress"
+	"github.com/davidwkirsch/api_spray/internal/schedule"
+	"github.com/davidwkirsch/api_spray/internal/takeover"
+	"github.com/davidwkirsch/api_spray/internal/targets"
 	"github.com/davidwkirsch/api_spray/pkg/types"
 )
 
 // Scanner is the main scanning engine
 type Scanner struct {
-	config      *types.Config
-	httpClient  *http.Client
-	progressMgr *progress.Manager
-	outputMgr   *output.Manager
-	stats       *Statistics
+	config        *types.Config
+	httpClient    *http.Client
+	replayClient  *http.Client
+	compareClient *http.Client
+	progressMgr   *progress.Manager
+	outputMgr     *output.Manager
+	takeover      *takeover.Detector
+	dashboard     *dashboard.Dashboard
+	dashboardOut  io.Writer
+	metrics       *metrics.Server
+	stats         *Statistics
+	logger        *slog.Logger
+	sinks         []Sink
+	matchers      []Matcher
+
+	vhostBaselines sync.Map
+	hostnames      sync.Map
+
+	// Certificate hostname tracking for subdomains mode
+	words    map[string]bool
+	sanSeen  map[string]bool
+	sanMutex sync.Mutex
+
+	// -schedule window, outside of which workers pause
+	window     *schedule.Window
+	paused     bool
+	pauseMutex sync.Mutex
+
+	// Protected paths queued for bypass probing, per target
+	bypassSeen   map[string]bool
+	bypassQueued map[string]int
+	bypassMutex  sync.Mutex
+
+	// Budgets: cancels the run once one is used up, and skips hosts that
+	// used up theirs
+	cancel      context.CancelCauseFunc
+	stopReason  string
+	runRequests int64
+	usage       map[string]*hostUsage
+	skipped     map[string]string
+	budgetMutex sync.Mutex
+
+	// Targets with skipped work, by the first batch holding it, and the
+	// targets with work skipped in the current batch
+	pending map[string]int
+	undone  map[string]bool
+
+	// Consecutive failures per target, and the work skipped while it was dead
+	health      map[string]*targetHealth
+	deadSkipped map[string]int64
+	healthMutex sync.Mutex
 }
 
 // Statistics tracks scan statistics
@@ -31,17 +86,88 @@ type Statistics struct {
 	errorCount    int64
 	timeoutCount  int64
 	filteredCount int64
+	skippedCount  int64
+
+	// Work items done so far, including those completed before a resume
+	completedCount int64
+
+	// Batch being processed, batches finished and work items waiting for a worker
+	currentBatch int64
+	lastBatch    int64
+	queued       int64
+
+	filteredByTarget map[string]int64
+	filteredMutex    sync.Mutex
 }
 
-// NewScanner creates a new scanner instance
-func NewScanner(config *types.Config) (*Scanner, error) {
-	return &Scanner{
-		config:      config,
-		httpClient:  http.NewClient(config),
-		progressMgr: progress.NewManager(config.OutDir),
-		outputMgr:   output.NewManager(config.OutDir),
-		stats:       &Statistics{},
-	}, nil
+// NewScanner creates a new scanner instance logging to logger
+func NewScanner(config *types.Config, logger *slog.Logger) (*Scanner, error) {
+	httpClient, err := http.NewClient(config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	replayClient, err := http.NewReplayClient(config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	compareClient, err := http.NewCompareClient(config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scanner{
+		config:        config,
+		httpClient:    httpClient,
+		replayClient:  replayClient,
+		compareClient: compareClient,
+		progressMgr:   progress.NewManager(config.OutDir, logger),
+		outputMgr:     output.NewManager(config, logger),
+		stats:         &Statistics{filteredByTarget: make(map[string]int64)},
+		dashboardOut:  os.Stdout,
+		logger:        logger,
+		sanSeen:       make(map[string]bool),
+		usage:         make(map[string]*hostUsage),
+		skipped:       make(map[string]string),
+		pending:       make(map[string]int),
+		undone:        make(map[string]bool),
+		health:        make(map[string]*targetHealth),
+		deadSkipped:   make(map[string]int64),
+	}
+
+	// Budgets count every request sent, not just one per word
+	for _, client := range []*http.Client{httpClient, replayClient, compareClient} {
+		if client != nil {
+			client.SetRequestHook(s.countRequest)
+		}
+	}
+
+	if config.Schedule != "" {
+		window, err := schedule.Parse(config.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		s.window = window
+	}
+
+	if config.Takeover && config.GetMode() == types.ModeSubdomains {
+		detector, err := takeover.NewDetector(s.httpClient)
+		if err != nil {
+			return nil, err
+		}
+		s.takeover = detector
+	}
+
+	return s, nil
+}
+
+// SetTokenRefresher replaces the refresher run when requests get a 401
+func (s *Scanner) SetTokenRefresher(refresher http.TokenRefresher) {
+	s.httpClient.SetTokenRefresher(refresher)
+	if s.replayClient != nil {
+		s.replayClient.SetTokenRefresher(refresher)
+	}
 }
 
 // Initialize initializes the scanner
@@ -51,6 +177,10 @@ func (s *Scanner) Initialize() error {
 
 // LoadProgress loads existing progress for resume functionality
 func (s *Scanner) LoadProgress() error {
+	// Carry statistics over so the final numbers cover the whole scan
+	if stats, err := output.ReadStats(s.config.OutDir); err == nil {
+		s.restoreStats(stats)
+	}
 	return s.progressMgr.LoadProgress()
 }
 
@@ -61,6 +191,14 @@ func (s *Scanner) LoadCompletedWork() error {
 
 // SaveProgress saves current progress
 func (s *Scanner) SaveProgress() error {
+	if progress := s.progressMgr.GetProgress(); progress != nil {
+		progress.Schemes = s.httpClient.Schemes()
+		progress.StopReason = s.StopReason()
+		progress.Pending = s.pendingSnapshot()
+	}
+	if err := s.outputMgr.WriteStats(s.StatsSnapshot()); err != nil {
+		s.logger.Warn("Failed to save stats", "error", err)
+	}
 	return s.progressMgr.SaveProgress()
 }
 
@@ -78,6 +216,177 @@ func (s *Scanner) GetStats() (total, success, errors, timeouts, filtered int64)
 		atomic.LoadInt64(&s.stats.filteredCount)
 }
 
+// StatsSnapshot returns the current statistics along with scan timing
+func (s *Scanner) StatsSnapshot() types.ScanStats {
+	total, success, errors, timeouts, filtered := s.GetStats()
+	stats := types.ScanStats{
+		Mode:             s.config.Mode,
+		TotalRequests:    total,
+		SuccessCount:     success,
+		ErrorCount:       errors,
+		TimeoutCount:     timeouts,
+		FilteredCount:    filtered,
+		FilteredByTarget: make(map[string]int64),
+		SkippedCount:     atomic.LoadInt64(&s.stats.skippedCount),
+		StopReason:       s.StopReason(),
+	}
+	if progress := s.progressMgr.GetProgress(); progress != nil {
+		stats.StartTime = progress.StartTime
+	}
+
+	s.stats.filteredMutex.Lock()
+	for target, count := range s.stats.filteredByTarget {
+		stats.FilteredByTarget[target] = count
+	}
+	s.stats.filteredMutex.Unlock()
+
+	s.budgetMutex.Lock()
+	if len(s.skipped) > 0 {
+		stats.SkippedHosts = make(map[string]string, len(s.skipped))
+		for host, reason := range s.skipped {
+			stats.SkippedHosts[host] = reason
+		}
+	}
+	s.budgetMutex.Unlock()
+
+	s.healthMutex.Lock()
+	if len(s.deadSkipped) > 0 {
+		stats.DeadTargets = make(map[string]int64, len(s.deadSkipped))
+		for target, count := range s.deadSkipped {
+			stats.DeadTargets[target] = count
+		}
+	}
+	s.healthMutex.Unlock()
+
+	return stats
+}
+
+// restoreStats seeds the statistics from a previous run of the same scan
+func (s *Scanner) restoreStats(stats *types.ScanStats) {
+	atomic.StoreInt64(&s.stats.totalRequests, stats.TotalRequests)
+	atomic.StoreInt64(&s.stats.successCount, stats.SuccessCount)
+	atomic.StoreInt64(&s.stats.errorCount, stats.ErrorCount)
+	atomic.StoreInt64(&s.stats.timeoutCount, stats.TimeoutCount)
+	atomic.StoreInt64(&s.stats.filteredCount, stats.FilteredCount)
+	atomic.StoreInt64(&s.stats.skippedCount, stats.SkippedCount)
+
+	s.stats.filteredMutex.Lock()
+	for target, count := range stats.FilteredByTarget {
+		s.stats.filteredByTarget[target] = count
+	}
+	s.stats.filteredMutex.Unlock()
+
+	// Dead targets get another chance, but keep their count of skipped work
+	s.healthMutex.Lock()
+	for target, count := range stats.DeadTargets {
+		s.deadSkipped[target] = count
+	}
+	s.healthMutex.Unlock()
+}
+
+// recordFiltered counts a result filtered as a false positive for target
+func (s *Scanner) recordFiltered(target string) {
+	s.UpdateStats("filtered", 1)
+
+	s.stats.filteredMutex.Lock()
+	s.stats.filteredByTarget[target]++
+	s.stats.filteredMutex.Unlock()
+}
+
+// startDashboard starts the live dashboard for the scan
+func (s *Scanner) startDashboard() {
+	s.dashboard = dashboard.New(func() dashboard.Counters {
+		total, success, errors, timeouts, filtered := s.GetStats()
+		counters := dashboard.Counters{
+			Total:     total,
+			Success:   success,
+			Errors:    errors,
+			Timeouts:  timeouts,
+			Filtered:  filtered,
+			Completed: atomic.LoadInt64(&s.stats.completedCount),
+		}
+		if progress := s.progressMgr.GetProgress(); progress != nil {
+			counters.TotalWork = int64(progress.TotalWork)
+		}
+		return counters
+	}, s.dashboardOut)
+
+	// Console log lines go above the status block instead of through it
+	if s.dashboard.Terminal() {
+		logging.Console.Set(s.dashboard.Writer())
+	}
+	s.dashboard.Start()
+}
+
+// stopDashboard stops the live dashboard and sends console logs back to stderr
+func (s *Scanner) stopDashboard() {
+	if s.dashboard.Terminal() {
+		logging.Console.Set(nil)
+	}
+	s.dashboard.Stop()
+}
+
+// SetDashboardOutput sets where the -dashboard is drawn, os.Stdout by default
+func (s *Scanner) SetDashboardOutput(w io.Writer) {
+	s.dashboardOut = w
+}
+
+// startMetrics starts serving metrics and the scan status
+func (s *Scanner) startMetrics() error {
+	s.metrics = metrics.New(s.config.MetricsAddr, s.status)
+	if err := s.metrics.Start(); err != nil {
+		return err
+	}
+	s.logger.Info("Serving metrics", "addr", s.config.MetricsAddr)
+	return nil
+}
+
+// status returns the live scan status served by the metrics server
+func (s *Scanner) status() metrics.Status {
+	status := metrics.Status{
+		LastBatch:      int(atomic.LoadInt64(&s.stats.lastBatch)),
+		CurrentBatch:   int(atomic.LoadInt64(&s.stats.currentBatch)),
+		CompletedCount: int(atomic.LoadInt64(&s.stats.completedCount)),
+		QueueDepth:     atomic.LoadInt64(&s.stats.queued),
+		Stats:          s.StatsSnapshot(),
+	}
+	// These are set before the scan starts and don't change while it runs
+	if progress := s.progressMgr.GetProgress(); progress != nil {
+		status.TotalBatches = progress.TotalBatches
+		status.TotalWork = progress.TotalWork
+		status.StartTime = progress.StartTime
+	}
+	return status
+}
+
+// saveFinalStats writes the statistics of a completed scan
+func (s *Scanner) saveFinalStats() {
+	stats := s.StatsSnapshot()
+	stats.EndTime = time.Now()
+	if err := s.outputMgr.WriteStats(stats); err != nil {
+		s.logger.Warn("Failed to save stats", "error", err)
+	}
+}
+
+// saveInterrupted saves progress after the scan was cancelled, so it can be resumed
+func (s *Scanner) saveInterrupted() {
+	if err := s.SaveProgress(); err != nil {
+		s.logger.Warn("Failed to save progress", "error", err)
+	}
+	if reason := s.StopReason(); reason != "" {
+		s.logger.Warn("Scan stopped, progress saved", "reason", reason, "outdir", s.config.OutDir)
+		return
+	}
+	s.logger.Warn("Scan interrupted, progress saved", "outdir", s.config.OutDir)
+}
+
+// logBatchStats logs the running statistics after a batch
+func (s *Scanner) logBatchStats(batch int) {
+	total, success, errors, timeouts, filtered := s.GetStats()
+	s.logger.Info("Batch completed", "batch", batch, "total", total, "success", success,
+		"errors", errors, "timeouts", timeouts, "filtered", filtered)
+}
+
 // UpdateStats updates internal statistics
 func (s *Scanner) UpdateStats(statType string, count int64) {
 	switch statType {
@@ -91,6 +400,8 @@ func (s *Scanner) UpdateStats(statType string, count int64) {
 		atomic.AddInt64(&s.stats.timeoutCount, count)
 	case "filtered":
 		atomic.AddInt64(&s.stats.filteredCount, count)
+	case "skipped":
+		atomic.AddInt64(&s.stats.skippedCount, count)
 	}
 }
 
@@ -98,48 +409,90 @@ func (s *Scanner) UpdateStats(statType string, count int64) {
 func (s *Scanner) TestURL(ctx context.Context, target, word, url string) types.Result {
 	s.UpdateStats("total", 1)
 
-	result := http.TestURL(ctx, s.httpClient, target, word, url, s.config.StatusCodes, s.config.DisableHTTP)
+	result := http.TestURL(ctx, s.httpClient, s.compareClient, target, word, url, s.config.StatusCodes, s.config.DisableHTTP)
+	s.categorizeResult(target, &result)
+
+	return result
+}
+
+// categorizeResult updates statistics and false positive tracking for a result
+func (s *Scanner) categorizeResult(target string, result *types.Result) {
+	if s.metrics != nil {
+		s.metrics.Observe(http.ExtractHost(target), *result)
+	}
+
+	dnsError := strings.Contains(strings.ToLower(result.Error), "no such host")
 
 	// Categorize errors for statistics
 	if result.Error != "" {
+		if dnsError {
+			// Don't count DNS errors in main error stats
+			s.logger.Debug("Host not found", "target", target, "word", result.Word, "url", result.URL)
+			return
+		}
+
 		if strings.Contains(result.Error, "timeout") {
 			s.UpdateStats("timeout", 1)
-		} else if strings.Contains(strings.ToLower(result.Error), "no such host") {
-			// Don't count DNS errors in main error stats
 		} else {
 			s.UpdateStats("error", 1)
 		}
-		return result
+		s.logger.Debug("Request failed", "target", target, "word", result.Word, "url", result.URL, "error", result.Error)
+		s.outputMgr.WriteError(*result)
+		return
 	}
 
-	// Check if status code is in allowed list
-	allowed := false
-	for _, code := range s.config.StatusCodes {
-		if result.StatusCode == code {
-			allowed = true
-			break
-		}
-	}
-
-	if allowed {
+	if s.matches(*result) {
 		// Track response size for false positive detection
 		s.progressMgr.TrackResponseSize(target, result.StatusCode, result.ContentLength)
 		s.UpdateStats("success", 1)
 	} else {
 		s.UpdateStats("error", 1)
 	}
+}
 
-	return result
+// Run executes the main scanning logic. When ctx is cancelled, requests in
+// flight are abandoned, progress is saved and ctx's error is returned. When
+// the scan uses up -max-time or -max-requests, it stops the same way and
+// returns a *StopError.
+func (s *Scanner) Run(ctx context.Context, targetList *targets.List, wordlist []string) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	s.budgetMutex.Lock()
+	s.cancel = cancel
+	s.stopReason = ""
+	s.budgetMutex.Unlock()
+
+	if s.config.MaxTime > 0 {
+		timer := time.AfterFunc(s.config.MaxTime, func() {
+			s.stop(fmt.Sprintf("max-time %s reached", s.config.MaxTime))
+		})
+		defer timer.Stop()
+	}
+
+	err := s.run(ctx, targetList, wordlist)
+	if reason := s.StopReason(); reason != "" && err != nil {
+		return &StopError{Reason: reason}
+	}
+	return err
 }
 
-// Run executes the main scanning logic
-func (s *Scanner) Run(targets, wordlist []string) error {
+// run scans the targets in batches of words
+func (s *Scanner) run(ctx context.Context, targetList *targets.List, wordlist []string) error {
+	if len(s.config.Ports) > 0 {
+		targetList = s.expandPorts(ctx, targetList)
+	}
+
+	if s.config.GetMode() == types.ModeParams {
+		return s.runParams(ctx, targetList, wordlist)
+	}
+
 	// Initialize progress tracking only if not already loaded
 	progress := s.progressMgr.GetProgress()
 	if progress == nil {
 		progress = &types.Progress{
 			TotalBatches:         (len(wordlist) + s.config.Batch - 1) / s.config.Batch,
-			TotalWork:            len(targets) * len(wordlist),
+			TotalWork:            targetList.Len() * len(wordlist),
 			StartTime:            time.Now(),
 			FalsePositiveTracker: types.NewFalsePositiveTracker(),
 		}
@@ -147,28 +500,59 @@ func (s *Scanner) Run(targets, wordlist []string) error {
 	} else {
 		// Update values that might have changed
 		progress.TotalBatches = (len(wordlist) + s.config.Batch - 1) / s.config.Batch
-		progress.TotalWork = len(targets) * len(wordlist)
+		progress.TotalWork = targetList.Len() * len(wordlist)
 		if progress.FalsePositiveTracker == nil {
 			progress.FalsePositiveTracker = types.NewFalsePositiveTracker()
 		}
 	}
 
+	// Skip the HTTPS/HTTP probing for hosts whose scheme we already know
+	s.httpClient.LoadSchemes(progress.Schemes)
+
+	// Batches before the last one done are only redone for the targets whose
+	// work was skipped in them
+	s.loadPending(progress.Pending)
+	retryEnd := progress.LastBatch
 	completedCount := s.progressMgr.CountCompleted()
-	startBatch := progress.LastBatch
+	startBatch := s.firstPending(progress.LastBatch)
 
-	fmt.Printf("Resume status: %d/%d items completed (%.1f%%)\n",
-		completedCount, progress.TotalWork,
-		float64(completedCount)/float64(progress.TotalWork)*100)
+	s.logger.Info("Resume status", "completed", completedCount, "total", progress.TotalWork,
+		"percent", math.Round(float64(completedCount)/float64(progress.TotalWork)*1000)/10)
 
-	if completedCount == progress.TotalWork {
-		fmt.Println("Scan already completed!")
+	if completedCount == progress.TotalWork && len(progress.Pending) == 0 && len(progress.SANCandidates) == 0 {
+		s.logger.Info("Scan already completed")
 		return nil
 	}
 
-	fmt.Printf("Starting from batch %d/%d\n", startBatch+1, progress.TotalBatches)
+	s.logger.Info("Starting from batch", "batch", startBatch+1, "batches", progress.TotalBatches)
+
+	atomic.StoreInt64(&s.stats.completedCount, int64(completedCount))
+	atomic.StoreInt64(&s.stats.lastBatch, int64(startBatch))
+	if s.config.MetricsAddr != "" {
+		if err := s.startMetrics(); err != nil {
+			return err
+		}
+		defer s.metrics.Stop()
+	}
+	if s.config.Dashboard {
+		s.startDashboard()
+		defer s.stopDashboard()
+	}
+
+	if s.config.GetMode() == types.ModeSubdomains {
+		s.words = make(map[string]bool, len(wordlist))
+		for _, word := range wordlist {
+			s.words[strings.Trim(word, "/")] = true
+		}
+		for target, labels := range progress.SANCandidates {
+			for _, label := range labels {
+				s.sanSeen[target+"|"+label] = true
+			}
+		}
+	}
 
 	// Process in batches
-	for batchNum := startBatch; batchNum < progress.TotalBatches; batchNum++ {
+	for batchNum := startBatch; batchNum < progress.TotalBatches; batchNum = s.nextBatch(batchNum, retryEnd) {
 		startIdx := batchNum * s.config.Batch
 		endIdx := startIdx + s.config.Batch
 		if endIdx > len(wordlist) {
@@ -177,38 +561,70 @@ func (s *Scanner) Run(targets, wordlist []string) error {
 
 		wordBatch := wordlist[startIdx:endIdx]
 
-		fmt.Printf("── Batch %d/%d (Words %d-%d) %s\n",
-			batchNum+1, progress.TotalBatches,
-			startIdx+1, endIdx,
-			time.Now().Format("15:04:05"))
+		s.logger.Info("Batch started", "batch", batchNum+1, "batches", progress.TotalBatches,
+			"first_word", startIdx+1, "last_word", endIdx)
+		atomic.StoreInt64(&s.stats.currentBatch, int64(batchNum+1))
 
-		if err := s.processBatch(targets, wordBatch); err != nil {
+		batchTargets := targetList
+		if batchNum < retryEnd {
+			batchTargets = s.pendingIn(targetList, batchNum)
+		}
+
+		if err := s.processBatch(ctx, batchTargets, wordBatch); err != nil {
+			if ctx.Err() != nil {
+				s.saveInterrupted()
+				return err
+			}
 			return fmt.Errorf("error processing batch %d: %w", batchNum, err)
 		}
 
 		// Update and save progress
-		progress.LastBatch = batchNum + 1
+		s.settleUndone(batchNum, retryEnd)
+		progress.LastBatch = max(progress.LastBatch, batchNum+1)
 		progress.CompletedCount = s.progressMgr.CountCompleted()
+		atomic.StoreInt64(&s.stats.lastBatch, int64(progress.LastBatch))
 		if err := s.SaveProgress(); err != nil {
-			log.Printf("Warning: failed to save progress: %v", err)
+			s.logger.Warn("Failed to save progress", "error", err)
 		}
 
-		// Print statistics
-		total, success, errors, timeouts, filtered := s.GetStats()
-		fmt.Printf("   Stats: %d total, %d success, %d errors, %d timeouts, %d filtered\n\n",
-			total, success, errors, timeouts, filtered)
+		s.logBatchStats(batchNum + 1)
+	}
+
+	// Follow up on hostnames found in certificates during the scan
+	if s.config.GetMode() == types.ModeSubdomains {
+		if err := s.runSANCandidates(ctx); err != nil {
+			if ctx.Err() != nil {
+				s.saveInterrupted()
+			}
+			return err
+		}
+	}
+
+	// Probe the 401 and 403 responses for bypasses
+	if s.config.Bypass {
+		if err := s.runBypass(ctx); err != nil {
+			if ctx.Err() != nil {
+				s.saveInterrupted()
+			}
+			return err
+		}
+	}
+
+	if err := s.finishPending(); err != nil {
+		return err
 	}
 
 	// Clean up progress file on completion
+	s.saveFinalStats()
 	s.progressMgr.CleanupProgressFile()
-	fmt.Println("Scan completed successfully!")
+	s.logger.Info("Scan completed successfully")
 
 	return nil
 }
 
 // processBatch processes a batch of words against all targets
-func (s *Scanner) processBatch(targets, words []string) error {
-	ctx, cancel := context.WithCancel(context.Background())
+func (s *Scanner) processBatch(ctx context.Context, targetList *targets.List, words []string) error {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// Create work channel
@@ -217,11 +633,11 @@ func (s *Scanner) processBatch(targets, words []string) error {
 	}, s.config.Threads*2)
 
 	// Count total work and completed work for this batch
-	totalWork := len(targets) * len(words)
+	totalWork := targetList.Len() * len(words)
 	completedWork := 0
 
 	// Pre-check completed work for this batch
-	for _, target := range targets {
+	for target := range targetList.All() {
 		for _, word := range words {
 			if s.progressMgr.IsCompleted(target, word) {
 				completedWork++
@@ -229,11 +645,11 @@ func (s *Scanner) processBatch(targets, words []string) error {
 		}
 	}
 
-	fmt.Printf("   Batch progress: %d/%d already completed\n", completedWork, totalWork)
+	s.logger.Debug("Batch progress", "completed", completedWork, "total", totalWork)
 
 	// If all work is completed, skip this batch
 	if completedWork == totalWork {
-		fmt.Printf("   Batch already completed, skipping...\n")
+		s.logger.Info("Batch already completed, skipping")
 		return nil
 	}
 
@@ -246,54 +662,109 @@ func (s *Scanner) processBatch(targets, words []string) error {
 		go func() {
 			defer wg.Done()
 			for job := range work {
-				// Skip if already completed
-				if s.progressMgr.IsCompleted(job.target, job.word) {
+				atomic.AddInt64(&s.stats.queued, -1)
+
+				// Skip if already completed, or left over after cancellation
+				if ctx.Err() != nil || s.progressMgr.IsCompleted(job.target, job.word) {
+					continue
+				}
+				if s.isSkipped(job.target) {
+					s.UpdateStats("skipped", 1)
+					s.leaveUndone(job.target)
+					continue
+				}
+				if !s.isAlive(ctx, job.target) {
+					s.UpdateStats("skipped", 1)
+					s.leaveUndone(job.target)
+					continue
+				}
+
+				s.waitForWindow(ctx)
+				s.throttle(ctx)
+				if ctx.Err() != nil {
 					continue
 				}
 
 				url := http.GenerateURL(job.target, job.word, s.config.GetMode())
-				result := s.TestURL(ctx, job.target, job.word, url)
 
-				// Check if this should be filtered as false positive
+				var result types.Result
 				shouldFilter := false
-				if result.StatusCode > 0 {
+				if s.config.GetMode() == types.ModeVHosts {
+					// Responses identical to the random-host baseline aren't real virtual hosts
+					result, shouldFilter = s.TestVHost(ctx, job.target, job.word, url)
+					if shouldFilter {
+						s.recordFiltered(job.target)
+					}
+				} else {
+					result = s.TestURL(ctx, job.target, job.word, url)
+				}
+
+				// Check if this should be filtered as false positive
+				if result.StatusCode > 0 && !shouldFilter {
 					shouldFilter = s.progressMgr.ShouldFilter(job.target, result.StatusCode, result.ContentLength)
 					if shouldFilter {
-						s.UpdateStats("filtered", 1)
+						s.recordFiltered(job.target)
 					}
 				}
 
+				// Requests cut short by cancellation are redone on resume
+				if ctx.Err() != nil {
+					continue
+				}
+				s.recordHealth(job.target, result)
+
 				// Determine if we should save this result
 				shouldSave := false
 
 				if result.StatusCode > 0 && !shouldFilter {
-					// Got an HTTP response and it's not filtered - check if it's a status code we care about
-					for _, code := range s.config.StatusCodes {
-						if result.StatusCode == code {
-							shouldSave = true
-							break
-						}
-					}
+					// Got an HTTP response and it's not filtered - check if it's one we care about
+					shouldSave = s.matches(result)
 				} else if result.Error != "" {
 					// Only save certain types of errors (not DNS failures)
 					shouldSave = output.ShouldSaveError(result.Error)
 				}
 
 				if shouldSave {
-					if err := s.outputMgr.WriteResult(result); err != nil {
-						log.Printf("Error writing result: %v", err)
+					if s.config.ResolveIPs {
+						result.Hostname = s.hostnameFor(ctx, job.target, result)
+					}
+					s.writeResult(result)
+					if result.StatusCode > 0 {
+						s.replay(ctx, result.URL, http.RequestOptions{Host: result.Host})
+					}
+				}
+
+				if s.config.Bypass {
+					s.collectBypass(job.target, result)
+				}
+
+				// Feed hostnames from certificates back as subdomain candidates
+				if s.config.GetMode() == types.ModeSubdomains {
+					s.collectSANs(job.target, result)
+				}
+
+				// Check subdomains for dangling CNAMEs, regardless of how the request went
+				if s.takeover != nil {
+					if finding := s.takeover.Check(ctx, job.target, http.ExtractHost(url)); finding != nil {
+						if err := s.outputMgr.WriteTakeover(*finding); err != nil {
+							s.logger.Error("Failed to write takeover result", "target", job.target, "word", job.word, "url", url, "error", err)
+						}
 					}
 				}
 
 				// Always mark as completed (even DNS failures and filtered results)
 				s.progressMgr.MarkCompleted(job.target, job.word)
+				atomic.AddInt64(&s.stats.completedCount, 1)
+				if s.dashboard != nil {
+					s.dashboard.RecordResult(result, shouldSave)
+				}
 
 				// Update processed count
-				atomic.AddInt64(&processedCount, 1)
+				processed := atomic.AddInt64(&processedCount, 1)
 
-				// Periodic progress update
-				if processedCount%100 == 0 {
-					fmt.Printf("   Processed: %d/%d\n", processedCount, totalWork-completedWork)
+				// Periodic progress update, unless the dashboard already shows it
+				if s.dashboard == nil && processed%100 == 0 {
+					s.logger.Info("Progress", "processed", processed, "total", totalWork-completedWork)
 				}
 			}
 		}()
@@ -302,15 +773,17 @@ func (s *Scanner) processBatch(targets, words []string) error {
 	// Send work
 	go func() {
 		defer close(work)
-		for _, target := range targets {
+		for target := range targetList.All() {
 			for _, word := range words {
 				// Only send work that hasn't been completed
 				if !s.progressMgr.IsCompleted(target, word) {
+					atomic.AddInt64(&s.stats.queued, 1)
 					select {
 					case work <- struct {
 						target, word string
 					}{target, word}:
 					case <-ctx.Done():
+						atomic.AddInt64(&s.stats.queued, -1)
 						return
 					}
 				}
@@ -321,6 +794,6 @@ func (s *Scanner) processBatch(targets, words []string) error {
 	// Wait for completion
 	wg.Wait()
 
-	fmt.Printf("   Batch completed: %d new requests processed\n", processedCount)
-	return nil
+	s.logger.Debug("Batch requests processed", "processed", processedCount)
+	return ctx.Err()
 }
@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// throttle waits out the -delay and -jitter before a worker's next request
+func (s *Scanner) throttle(ctx context.Context) {
+	delay := s.config.Delay
+	if s.config.Jitter > 0 {
+		delay += rand.N(s.config.Jitter)
+	}
+	if delay > 0 {
+		sleep(ctx, delay)
+	}
+}
+
+// waitForWindow blocks while the time is outside the -schedule window. The
+// first worker to notice saves progress, so a scan stopped while paused can be
+// resumed from there.
+func (s *Scanner) waitForWindow(ctx context.Context) {
+	if s.window == nil || s.window.Contains(time.Now()) {
+		return
+	}
+
+	s.pauseMutex.Lock()
+	if !s.paused {
+		s.paused = true
+		s.logger.Info("Outside the schedule window, pausing", "schedule", s.window.String(),
+			"resume_at", s.window.Next(time.Now()).Format(time.RFC3339))
+		s.checkpoint()
+	}
+	s.pauseMutex.Unlock()
+
+	sleep(ctx, time.Until(s.window.Next(time.Now())))
+
+	s.pauseMutex.Lock()
+	if s.paused && ctx.Err() == nil {
+		s.paused = false
+		s.logger.Info("Inside the schedule window, resuming", "schedule", s.window.String())
+	}
+	s.pauseMutex.Unlock()
+}
+
+// checkpoint saves progress while workers may still be running
+func (s *Scanner) checkpoint() {
+	s.sanMutex.Lock()
+	defer s.sanMutex.Unlock()
+	s.bypassMutex.Lock()
+	defer s.bypassMutex.Unlock()
+
+	if err := s.SaveProgress(); err != nil {
+		s.logger.Warn("Failed to save progress", "error", err)
+	}
+}
+
+// sleep waits for d or until ctx is cancelled
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"slices"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// Sink receives every result the scan saves
+type Sink interface {
+	WriteResult(result types.Result) error
+}
+
+// Matcher decides whether a response is a hit worth saving
+type Matcher interface {
+	Match(result types.Result) bool
+}
+
+// StatusMatcher matches responses with one of its status codes
+type StatusMatcher []int
+
+// Match reports whether the result's status code is in the list
+func (m StatusMatcher) Match(result types.Result) bool {
+	return slices.Contains(m, result.StatusCode)
+}
+
+// AddSink adds a sink that receives saved results after they are written to
+// the output directory
+func (s *Scanner) AddSink(sink Sink) {
+	s.sinks = append(s.sinks, sink)
+}
+
+// SetMatchers replaces the status code matcher; a response is saved when any
+// of the matchers matches it
+func (s *Scanner) SetMatchers(matchers ...Matcher) {
+	s.matchers = matchers
+}
+
+// matches reports whether a response should be saved
+func (s *Scanner) matches(result types.Result) bool {
+	if len(s.matchers) == 0 {
+		return StatusMatcher(s.config.StatusCodes).Match(result)
+	}
+	for _, matcher := range s.matchers {
+		if matcher.Match(result) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResult writes a saved result to the output directory and every sink
+func (s *Scanner) writeResult(result types.Result) {
+	if err := s.outputMgr.WriteResult(result); err != nil {
+		s.logger.Error("Failed to write result", "target", result.Target, "word", result.Word, "url", result.URL, "error", err)
+	}
+	for _, sink := range s.sinks {
+		if err := sink.WriteResult(result); err != nil {
+			s.logger.Error("Failed to write result to sink", "target", result.Target, "word", result.Word, "url", result.URL, "error", err)
+		}
+	}
+}
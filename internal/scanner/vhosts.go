@@ -0,0 +1,64 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// vhostBaseline records how a target answers for a virtual host that doesn't exist
+type vhostBaseline struct {
+	statusCode int
+	size       int64
+	err        string
+}
+
+// vhostBaselineEntry holds a target's baseline, requested again until a
+// request for it succeeds
+type vhostBaselineEntry struct {
+	mutex    sync.Mutex
+	baseline vhostBaseline
+	done     bool
+}
+
+// getVHostBaseline returns the baseline for target, requesting it on first
+// use and after a failed request
+func (s *Scanner) getVHostBaseline(ctx context.Context, target string) vhostBaseline {
+	value, _ := s.vhostBaselines.LoadOrStore(target, &vhostBaselineEntry{})
+	entry := value.(*vhostBaselineEntry)
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+	if entry.done {
+		return entry.baseline
+	}
+
+	url := http.GenerateURL(target, "", types.ModeVHosts)
+	host := http.RandomVHost(http.VHostDomain(target, s.config.VHostDomain))
+	result, size := http.TestVHost(ctx, s.httpClient, target, "", url, host, s.config.StatusCodes, s.config.DisableHTTP)
+
+	entry.baseline = vhostBaseline{statusCode: result.StatusCode, size: size, err: result.Error}
+	entry.done = result.Error == ""
+	if entry.done {
+		s.logger.Info("VHost baseline", "target", target, "host", host, "status", result.StatusCode, "size", size)
+	}
+	return entry.baseline
+}
+
+// TestVHost tests a single virtual host against a target and reports whether
+// the response matched the target's baseline for unknown hosts
+func (s *Scanner) TestVHost(ctx context.Context, target, word, url string) (types.Result, bool) {
+	baseline := s.getVHostBaseline(ctx, target)
+	host := http.GenerateVHost(word, http.VHostDomain(target, s.config.VHostDomain))
+
+	s.UpdateStats("total", 1)
+	result, size := http.TestVHost(ctx, s.httpClient, target, word, url, host, s.config.StatusCodes, s.config.DisableHTTP)
+	s.categorizeResult(target, &result)
+
+	matchesBaseline := result.Error == "" && baseline.err == "" &&
+		result.StatusCode == baseline.statusCode && size == baseline.size
+
+	return result, matchesBaseline
+}
@@ -0,0 +1,89 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily time window, such as 22:00-06:00 UTC. Windows whose end is
+// before their start span midnight.
+type Window struct {
+	spec     string
+	start    int // minutes after midnight
+	end      int
+	location *time.Location
+}
+
+// Parse parses a window of the form "HH:MM-HH:MM [zone]". The zone is UTC,
+// Local or an IANA name such as Europe/Berlin, and defaults to Local.
+func Parse(spec string) (*Window, error) {
+	fields := strings.Fields(strings.ReplaceAll(spec, "–", "-"))
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid schedule %q (use HH:MM-HH:MM [zone])", spec)
+	}
+
+	from, to, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid schedule %q (use HH:MM-HH:MM [zone])", spec)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid schedule %q: window is empty", spec)
+	}
+
+	location := time.Local
+	if len(fields) == 2 {
+		location, err = time.LoadLocation(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+	}
+
+	return &Window{spec: spec, start: start, end: end, location: location}, nil
+}
+
+// parseClock parses HH:MM into minutes after midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// String returns the window as it was given
+func (w *Window) String() string {
+	return w.spec
+}
+
+// Contains reports whether t falls inside the window
+func (w *Window) Contains(t time.Time) bool {
+	t = t.In(w.location)
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// Next returns when the window next opens after t, or t if it is open
+func (w *Window) Next(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+
+	local := t.In(w.location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), w.start/60, w.start%60, 0, 0, w.location)
+	if !next.After(local) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,143 @@
+package takeover
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+//go:embed fingerprints.json
+var fingerprintData []byte
+
+// Fingerprint describes a service that is prone to subdomain takeovers
+type Fingerprint struct {
+	Service     string   `json:"service"`
+	CNAME       []string `json:"cname"`
+	Fingerprint []string `json:"fingerprint"`
+	NXDomain    bool     `json:"nxdomain"`
+	// Verify marks fingerprints that other servers' error pages match too,
+	// so a match needs checking by hand
+	Verify bool `json:"verify"`
+}
+
+// Detector checks hosts for dangling CNAME records pointing at unclaimed services
+type Detector struct {
+	fingerprints []Fingerprint
+	httpClient   *http.Client
+	resolver     *net.Resolver
+	checked      sync.Map
+}
+
+// NewDetector creates a new takeover detector using the embedded fingerprints
+func NewDetector(httpClient *http.Client) (*Detector, error) {
+	var fingerprints []Fingerprint
+	if err := json.Unmarshal(fingerprintData, &fingerprints); err != nil {
+		return nil, fmt.Errorf("failed to parse takeover fingerprints: %w", err)
+	}
+
+	return &Detector{
+		fingerprints: fingerprints,
+		httpClient:   httpClient,
+		resolver:     net.DefaultResolver,
+	}, nil
+}
+
+// Check resolves the CNAME for host and compares it against known fingerprints.
+// Each host is only checked once, unless its lookup failed for another reason
+// than the host not existing; nil is returned when nothing was found.
+func (d *Detector) Check(ctx context.Context, target, host string) *types.TakeoverResult {
+	if _, seen := d.checked.LoadOrStore(host, true); seen {
+		return nil
+	}
+
+	cname, err := d.resolver.LookupCNAME(ctx, host)
+	if err != nil {
+		// Hosts that don't exist stay checked; other failures may pass
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			d.checked.Delete(host)
+		}
+		return nil
+	}
+	if cname == "" {
+		return nil
+	}
+	cname = strings.TrimSuffix(strings.ToLower(cname), ".")
+	if cname == strings.ToLower(host) {
+		return nil
+	}
+
+	fp := d.match(cname)
+	if fp == nil {
+		return nil
+	}
+
+	result := &types.TakeoverResult{
+		Target:  target,
+		Host:    host,
+		CNAME:   cname,
+		Service: fp.Service,
+	}
+
+	// A CNAME into the service whose own target no longer resolves is a strong signal
+	if _, err := d.resolver.LookupHost(ctx, cname); err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			result.Evidence = "NXDOMAIN for CNAME target"
+			return result
+		}
+	}
+	if fp.NXDomain || len(fp.Fingerprint) == 0 {
+		return nil
+	}
+
+	body := d.fetchBody(ctx, host)
+	for _, pattern := range fp.Fingerprint {
+		if strings.Contains(body, pattern) {
+			result.Evidence = pattern
+			if fp.Verify {
+				result.Evidence += " (generic error page, verify manually)"
+			}
+			return result
+		}
+	}
+
+	return nil
+}
+
+// match returns the fingerprint whose CNAME patterns match the given record
+func (d *Detector) match(cname string) *Fingerprint {
+	for i := range d.fingerprints {
+		for _, pattern := range d.fingerprints[i].CNAME {
+			if strings.Contains(cname, pattern) {
+				return &d.fingerprints[i]
+			}
+		}
+	}
+	return nil
+}
+
+// fetchBody fetches the response body for host, trying HTTPS then HTTP
+func (d *Detector) fetchBody(ctx context.Context, host string) string {
+	for _, scheme := range []string{"https://", "http://"} {
+		resp, err := d.httpClient.MakeRequest(ctx, scheme+host+"/")
+		if err != nil {
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024)) // Limit to 1MB
+		resp.Body.Close()
+		if err == nil {
+			return string(body)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,242 @@
+package targets
+
+import (
+	"fmt"
+	"iter"
+	"net/netip"
+	"strings"
+)
+
+// maxRangeSize bounds a single CIDR or IP range, the size of an IPv4 /8
+const maxRangeSize = 1 << 24
+
+// List is an ordered list of targets. CIDR blocks and IP ranges are kept as a
+// start address and a count, and only turned into targets when accessed; so
+// are targets expanded across ports.
+type List struct {
+	entries []entry
+	length  int
+}
+
+// entry is either a literal target or a range of consecutive addresses,
+// optionally expanded across ports. Its targets are numbered address by
+// address and then port by port, and it holds count of them from skip on.
+type entry struct {
+	literal string
+	start   netip.Addr
+	ports   []int
+	skip    int
+	count   int
+}
+
+// target returns the i-th target of the entry
+func (e entry) target(i int) string {
+	i += e.skip
+	port := 0
+	if len(e.ports) > 0 {
+		port = e.ports[i%len(e.ports)]
+		i /= len(e.ports)
+	}
+
+	target := e.literal
+	if target == "" {
+		target = addOffset(e.start, i).String()
+	}
+	if port > 0 {
+		scheme, _, _, _ := SplitTarget(target)
+		target = WithPort(target, scheme, port)
+	}
+	return target
+}
+
+// NewList parses target lines into a list. Lines holding a CIDR block
+// (10.0.0.0/24) or an IP range (10.0.0.1-10.0.0.50 or 10.0.0.1-50) are
+// expanded into one target per address; anything else is kept as is.
+func NewList(lines []string) (*List, error) {
+	list := &List{}
+	for _, line := range lines {
+		if err := list.add(line); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// add appends a target line to the list
+func (l *List) add(line string) error {
+	start, count, isRange, err := parseRange(line)
+	if err != nil {
+		return err
+	}
+
+	if isRange {
+		l.entries = append(l.entries, entry{start: start, count: count})
+		l.length += count
+	} else {
+		l.entries = append(l.entries, entry{literal: line, count: 1})
+		l.length++
+	}
+	return nil
+}
+
+// Len returns the number of targets in the list, with ranges expanded
+func (l *List) Len() int {
+	return l.length
+}
+
+// At returns the i-th target in the list
+func (l *List) At(i int) string {
+	for _, e := range l.entries {
+		if i < e.count {
+			return e.target(i)
+		}
+		i -= e.count
+	}
+	return ""
+}
+
+// All iterates over every target in the list, expanding ranges as it goes
+func (l *List) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, e := range l.entries {
+			if e.literal != "" && len(e.ports) == 0 {
+				if !yield(e.literal) {
+					return
+				}
+				continue
+			}
+
+			for i := 0; i < e.count; i++ {
+				if !yield(e.target(i)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Slice returns the targets from index start up to end as a new list
+func (l *List) Slice(start, end int) *List {
+	sub := &List{}
+	offset := 0
+	for _, e := range l.entries {
+		count := e.count
+		from := max(start-offset, 0)
+		to := min(end-offset, count)
+		if from < to {
+			e.skip += from
+			e.count = to - from
+			sub.entries = append(sub.entries, e)
+			sub.length += to - from
+		}
+		offset += count
+	}
+	return sub
+}
+
+// WithPorts returns the list with every target expanded across ports, keeping
+// each target's scheme and path. Like ranges, the expanded targets are only
+// built when accessed.
+func (l *List) WithPorts(ports []int) *List {
+	expanded := &List{}
+	for _, e := range l.entries {
+		if len(e.ports) > 0 {
+			// Already expanded: expand its targets one by one
+			for i := 0; i < e.count; i++ {
+				expanded.entries = append(expanded.entries, entry{literal: e.target(i), ports: ports, count: len(ports)})
+			}
+			continue
+		}
+		if e.literal == "" {
+			e.start = addOffset(e.start, e.skip)
+		}
+		expanded.entries = append(expanded.entries, entry{
+			literal: e.literal,
+			start:   e.start,
+			ports:   ports,
+			count:   e.count * len(ports),
+		})
+	}
+	expanded.length = l.length * len(ports)
+	return expanded
+}
+
+// Strings returns every target in the list, fully expanded
+func (l *List) Strings() []string {
+	targets := make([]string, 0, l.length)
+	for target := range l.All() {
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// parseRange parses a CIDR block or IP range. isRange is false for lines that
+// are neither, which are plain targets.
+func parseRange(line string) (start netip.Addr, count int, isRange bool, err error) {
+	if prefix, perr := netip.ParsePrefix(line); perr == nil {
+		prefix = prefix.Masked()
+		hostBits := prefix.Addr().BitLen() - prefix.Bits()
+		if hostBits > 24 {
+			return start, 0, true, fmt.Errorf("range %s is too large (max /%d)", line, prefix.Addr().BitLen()-24)
+		}
+
+		start = prefix.Addr()
+		count = 1 << hostBits
+		// Skip the network and broadcast addresses of regular IPv4 networks
+		if start.Is4() && hostBits >= 2 {
+			start = start.Next()
+			count -= 2
+		}
+		return start, count, true, nil
+	}
+
+	from, to, found := strings.Cut(line, "-")
+	if !found {
+		return start, 0, false, nil
+	}
+	first, ferr := netip.ParseAddr(strings.TrimSpace(from))
+	if ferr != nil {
+		return start, 0, false, nil
+	}
+
+	to = strings.TrimSpace(to)
+	last, lerr := netip.ParseAddr(to)
+	if lerr != nil && first.Is4() {
+		// Short form: 10.0.0.1-50 replaces the last octet
+		octets := first.As4()
+		prefix := fmt.Sprintf("%d.%d.%d.", octets[0], octets[1], octets[2])
+		last, lerr = netip.ParseAddr(prefix + to)
+	}
+	if lerr != nil {
+		return start, 0, true, fmt.Errorf("invalid IP range %s", line)
+	}
+	if first.BitLen() != last.BitLen() || last.Less(first) {
+		return start, 0, true, fmt.Errorf("invalid IP range %s", line)
+	}
+
+	count = 1
+	for addr := first; addr != last; addr = addr.Next() {
+		if count >= maxRangeSize {
+			return start, 0, true, fmt.Errorf("range %s is too large (max %d addresses)", line, maxRangeSize)
+		}
+		count++
+	}
+	return first, count, true, nil
+}
+
+// addOffset returns the address n places after addr
+func addOffset(addr netip.Addr, n int) netip.Addr {
+	bytes := addr.As16()
+	carry := uint64(n)
+	for i := len(bytes) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(bytes[i]) + carry&0xff
+		bytes[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+
+	result := netip.AddrFrom16(bytes)
+	if addr.Is4() {
+		return result.Unmap()
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package targets
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestListSlice(t *testing.T) {
+	tests := []struct {
+		name       string
+		lines      []string
+		ports      []int
+		start, end int
+		want       []string
+	}{
+		{
+			name:  "literals",
+			lines: []string{"a", "b", "c"},
+			start: 1, end: 3,
+			want: []string{"b", "c"},
+		},
+		{
+			name:  "CIDR then literals",
+			lines: []string{"10.0.0.0/29", "a", "b"},
+			start: 3, end: 5,
+			want: []string{"10.0.0.4", "10.0.0.5"},
+		},
+		{
+			name:  "across a CIDR into literals",
+			lines: []string{"10.0.0.0/29", "a", "b"},
+			start: 5, end: 8,
+			want: []string{"10.0.0.6", "a", "b"},
+		},
+		{
+			name:  "range then literal",
+			lines: []string{"10.0.0.1-4", "a"},
+			start: 2, end: 5,
+			want: []string{"10.0.0.3", "10.0.0.4", "a"},
+		},
+		{
+			name:  "ports on literals",
+			lines: []string{"x", "y"},
+			ports: []int{1, 2, 3},
+			start: 2, end: 4,
+			want: []string{"x:3", "y:1"},
+		},
+		{
+			name:  "ports on a range",
+			lines: []string{"10.0.0.1-2", "y"},
+			ports: []int{1, 2},
+			start: 1, end: 5,
+			want: []string{"10.0.0.1:2", "10.0.0.2:1", "10.0.0.2:2", "y:1"},
+		},
+		{
+			name:  "past the end",
+			lines: []string{"a", "b"},
+			start: 1, end: 10,
+			want: []string{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := NewList(tt.lines)
+			if err != nil {
+				t.Fatalf("NewList: %v", err)
+			}
+			if len(tt.ports) > 0 {
+				list = list.WithPorts(tt.ports)
+			}
+
+			sub := list.Slice(tt.start, tt.end)
+			if got := sub.Strings(); !slices.Equal(got, tt.want) {
+				t.Errorf("Slice(%d, %d) = %v, want %v", tt.start, tt.end, got, tt.want)
+			}
+			if sub.Len() != len(tt.want) {
+				t.Errorf("Slice(%d, %d).Len() = %d, want %d", tt.start, tt.end, sub.Len(), len(tt.want))
+			}
+		})
+	}
+}
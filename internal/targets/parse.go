@@ -0,0 +1,239 @@
+package targets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// Load reads targets from a file, or from stdin when filename is "-", and
+// normalizes them for the scan mode. See Parse for the accepted formats.
+func Load(filename string, mode types.ScanMode, logger *slog.Logger) ([]string, error) {
+	if filename == "-" {
+		return Parse(os.Stdin, mode, logger)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file, mode, logger)
+}
+
+// Parse reads targets in any of the supported formats: one target per line
+// (domains, URLs with paths, host:port, CIDR blocks and IP ranges), httpx JSON
+// lines, or nmap XML. Parsed entries are normalized into what GenerateURL
+// expects for the mode, and duplicates are dropped. Malformed JSON lines are
+// skipped with a warning.
+func Parse(r io.Reader, mode types.ScanMode, logger *slog.Logger) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []string
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("<?xml")) || bytes.HasPrefix(trimmed, []byte("<nmaprun")) {
+		origins, err := parseNmapXML(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		for _, origin := range origins {
+			entries = append(entries, normalize(origin, mode))
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for number := 1; scanner.Scan(); number++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if strings.HasPrefix(line, "{") {
+				target, err := parseHttpxLine(line)
+				if err != nil {
+					logger.Warn("Skipping target line", "line", number, "error", err)
+					continue
+				}
+				if target != "" {
+					entries = append(entries, normalize(target, mode))
+				}
+				continue
+			}
+			entries = append(entries, normalizeLine(line, mode))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool, len(entries))
+	targets := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry != "" && !seen[entry] {
+			seen[entry] = true
+			targets = append(targets, entry)
+		}
+	}
+	return targets, nil
+}
+
+// normalizeLine normalizes a plain text line. Lines that already carry a
+// wildcard and ranges are left as written; bare hosts are normalized like
+// host:port and URLs.
+func normalizeLine(line string, mode types.ScanMode) string {
+	if strings.Contains(line, "*") {
+		return line
+	}
+	if _, _, isRange, _ := parseRange(line); isRange {
+		return line
+	}
+	return normalize(line, mode)
+}
+
+// normalize turns a URL or host:port into the target form GenerateURL expects:
+// the bare host for subdomains, the origin for vhosts, the full URL for params,
+// the base path for directories, and the base path plus /* for wildcards
+func normalize(target string, mode types.ScanMode) string {
+	scheme, host, port, rest := SplitTarget(target)
+
+	// Query strings and fragments only matter when discovering parameters
+	path := rest
+	if mode != types.ModeParams {
+		if i := strings.IndexAny(path, "?#"); i >= 0 {
+			path = path[:i]
+		}
+	} else if i := strings.Index(path, "#"); i >= 0 {
+		path = path[:i]
+	}
+	path = strings.TrimSuffix(path, "/")
+
+	origin := host
+	if port > 0 && !isDefaultPort(scheme, port) {
+		origin = net.JoinHostPort(host, strconv.Itoa(port))
+	} else if strings.Contains(host, ":") {
+		origin = "[" + host + "]"
+	}
+	if scheme != "" {
+		origin = scheme + "://" + origin
+	}
+
+	switch mode {
+	case types.ModeSubdomains:
+		return host
+	case types.ModeVHosts:
+		return origin
+	case types.ModeWildcards:
+		return origin + path + "/*"
+	default:
+		return origin + path
+	}
+}
+
+// isDefaultPort reports whether port is the default for scheme
+func isDefaultPort(scheme string, port int) bool {
+	return (scheme == "https" && port == 443) || (scheme == "http" && port == 80)
+}
+
+// httpxResult holds the fields of an httpx JSON line that identify the target
+type httpxResult struct {
+	URL    string `json:"url"`
+	Input  string `json:"input"`
+	Host   string `json:"host"`
+	Port   string `json:"port"`
+	Scheme string `json:"scheme"`
+}
+
+// parseHttpxLine returns the target of an httpx JSON line
+func parseHttpxLine(line string) (string, error) {
+	var result httpxResult
+	if err := json.Unmarshal([]byte(line), &result); err != nil {
+		return "", fmt.Errorf("failed to parse JSON target line: %w", err)
+	}
+
+	switch {
+	case result.URL != "":
+		return result.URL, nil
+	case result.Host != "" && result.Port != "":
+		target := net.JoinHostPort(result.Host, result.Port)
+		if result.Scheme != "" {
+			target = result.Scheme + "://" + target
+		}
+		return target, nil
+	default:
+		return result.Input, nil
+	}
+}
+
+// nmapRun is the subset of nmap's XML output needed to find web services
+type nmapRun struct {
+	Hosts []struct {
+		Addresses []struct {
+			Addr     string `xml:"addr,attr"`
+			AddrType string `xml:"addrtype,attr"`
+		} `xml:"address"`
+		Hostnames []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"hostnames>hostname"`
+		Ports []struct {
+			PortID int `xml:"portid,attr"`
+			State  struct {
+				State string `xml:"state,attr"`
+			} `xml:"state"`
+			Service struct {
+				Name   string `xml:"name,attr"`
+				Tunnel string `xml:"tunnel,attr"`
+			} `xml:"service"`
+		} `xml:"ports>port"`
+	} `xml:"host"`
+}
+
+// parseNmapXML returns an origin for every open web port in nmap XML output
+func parseNmapXML(data []byte) ([]string, error) {
+	var run nmapRun
+	if err := xml.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to parse nmap XML: %w", err)
+	}
+
+	var origins []string
+	for _, host := range run.Hosts {
+		name := ""
+		if len(host.Hostnames) > 0 {
+			name = host.Hostnames[0].Name
+		}
+		for _, addr := range host.Addresses {
+			if name == "" && addr.AddrType != "mac" {
+				name = addr.Addr
+			}
+		}
+		if name == "" {
+			continue
+		}
+
+		for _, port := range host.Ports {
+			service := port.Service.Name
+			if port.State.State != "open" || (service != "" && !strings.Contains(service, "http")) {
+				continue
+			}
+
+			scheme := "http"
+			if port.Service.Tunnel == "ssl" || strings.Contains(service, "https") {
+				scheme = "https"
+			}
+			origins = append(origins, scheme+"://"+net.JoinHostPort(name, strconv.Itoa(port.PortID)))
+		}
+	}
+	return origins, nil
+}
@@ -0,0 +1,136 @@
+package targets
+
+import (
+	"context"
+	"crypto/tls"
+	"iter"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Origin is a host and port together with the scheme it answered on
+type Origin struct {
+	Scheme string
+	Host   string
+	Port   int
+}
+
+// Key returns the host:port the origin is reached on
+func (o Origin) Key() string {
+	return net.JoinHostPort(o.Host, strconv.Itoa(o.Port))
+}
+
+// SplitTarget splits a target into its scheme, host, port and the rest of the
+// target (path, wildcards), any of which may be empty
+func SplitTarget(target string) (scheme, host string, port int, rest string) {
+	if i := strings.Index(target, "://"); i >= 0 {
+		scheme = target[:i]
+		target = target[i+3:]
+	}
+
+	hostPort := target
+	if i := strings.Index(target, "/"); i >= 0 {
+		hostPort = target[:i]
+		rest = target[i:]
+	}
+
+	host = hostPort
+	if h, p, err := net.SplitHostPort(hostPort); err == nil {
+		host = h
+		port, _ = strconv.Atoi(p)
+	}
+	return scheme, host, port, rest
+}
+
+// WithPort rewrites target to point at the given scheme and port, keeping its
+// path. An empty scheme leaves the target without one.
+func WithPort(target, scheme string, port int) string {
+	_, host, _, rest := SplitTarget(target)
+
+	origin := net.JoinHostPort(host, strconv.Itoa(port))
+	if scheme == "" {
+		return origin + rest
+	}
+	return scheme + "://" + origin + rest
+}
+
+// ProbeOrigins checks which host/port combinations accept TCP connections and
+// whether they complete a TLS handshake, using up to workers concurrent dials.
+// Only live origins are returned, keyed by host:port. Host names are probed
+// once; addresses, which ranges yield by the million, aren't deduplicated.
+func ProbeOrigins(ctx context.Context, hosts iter.Seq[string], ports []int, timeout time.Duration, workers int) map[string]Origin {
+	type job struct {
+		host string
+		port int
+	}
+
+	jobs := make(chan job)
+	live := make(map[string]Origin)
+	var liveMutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				scheme, ok := probe(ctx, j.host, j.port, timeout)
+				if !ok {
+					continue
+				}
+				origin := Origin{Scheme: scheme, Host: j.host, Port: j.port}
+				liveMutex.Lock()
+				live[origin.Key()] = origin
+				liveMutex.Unlock()
+			}
+		}()
+	}
+
+	seen := make(map[string]bool)
+send:
+	for host := range hosts {
+		if _, err := netip.ParseAddr(host); err != nil {
+			if seen[host] {
+				continue
+			}
+			seen[host] = true
+		}
+		for _, port := range ports {
+			select {
+			case jobs <- job{host, port}:
+			case <-ctx.Done():
+				break send
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return live
+}
+
+// probe reports whether host:port accepts connections, and whether it speaks TLS
+func probe(ctx context.Context, host string, port int, timeout time.Duration) (string, bool) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: timeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return "", false
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	tlsConn := tls.Client(conn, &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         host,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return "http", true
+	}
+	return "https", true
+}
@@ -3,72 +3,57 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"strings"
-	"time"
 
 	"github.com/davidwkirsch/api_spray/internal/config"
-	"github.com/davidwkirsch/api_spray/internal/scanner"
 )
 
-func main() {
-	// Parse command line flags
-	cfg := config.ParseFlags()
-
-	// Load input files
-	targets, err := config.LoadLines(cfg.TargetsFile)
-	if err != nil {
-		log.Fatalf("Failed to load targets: %v", err)
-	}
+const usage = `Usage: %[1]s <command> [options]
 
-	wordlist, err := config.LoadLines(cfg.Wordlist)
-	if err != nil {
-		log.Fatalf("Failed to load wordlist: %v", err)
-	}
+Commands:
+  scan        Spray words across targets
+  resume      Resume an interrupted scan from its output directory
+  report      Cluster the results of a scan into unique findings
+  merge       Combine the results of several scans
+  diff        Compare the results of two scans
+  calibrate   Show how targets answer for words that don't exist
 
-	// Create scanner
-	scan, err := scanner.NewScanner(cfg)
-	if err != nil {
-		log.Fatalf("Failed to create scanner: %v", err)
-	}
-	defer scan.Close()
+Run '%[1]s <command> -h' for the options of a command.
+`
 
-	// Initialize scanner
-	if err := scan.Initialize(); err != nil {
-		log.Fatalf("Failed to initialize scanner: %v", err)
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		os.Exit(1)
 	}
 
-	// Handle resume functionality
-	if cfg.Resume {
-		// Load existing progress and results
-		if err := scan.LoadProgress(); err != nil {
-			log.Printf("Warning: %v", err)
+	args := os.Args[2:]
+	switch os.Args[1] {
+	case "scan":
+		runScan(config.ParseScanFlags(args))
+	case "resume":
+		cfg, err := config.ParseResumeFlags(args)
+		if err != nil {
+			log.Fatalf("Failed to load scan: %v", err)
 		}
-
-		if err := scan.LoadCompletedWork(); err != nil {
-			log.Printf("Warning: %v", err)
+		runScan(cfg)
+	case "report":
+		runReport(args)
+	case "merge":
+		runMerge(args)
+	case "diff":
+		runDiff(args)
+	case "calibrate":
+		runCalibrate(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+	default:
+		// Flags without a command start a scan, as before there were commands
+		if !strings.HasPrefix(os.Args[1], "-") {
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n"+usage, os.Args[1], os.Args[0])
+			os.Exit(1)
 		}
+		runScan(config.ParseScanFlags(os.Args[1:]))
 	}
-
-	// Print banner
-	fmt.Printf("\n=== Go API Spray Scanner ===\n")
-	fmt.Printf("Mode: %s\n", strings.ToUpper(cfg.Mode))
-	fmt.Printf("Targets: %d | Words: %d | Threads: %d | Batch: %d\n",
-		len(targets), len(wordlist), cfg.Threads, cfg.Batch)
-	fmt.Printf("Timeout: %v | Status Codes: %v\n", cfg.Timeout, cfg.StatusCodes)
-	if cfg.DisableHTTP {
-		fmt.Println("HTTP fallback: DISABLED")
-	}
-	fmt.Printf("Started: %s\n\n", time.Now().Format("15:04:05"))
-
-	// Run scan
-	if err := scan.Run(targets, wordlist); err != nil {
-		log.Fatalf("Scan failed: %v", err)
-	}
-
-	// Print final statistics
-	total, success, errors, timeouts, filtered := scan.GetStats()
-	fmt.Printf("Scan completed: %s\n", time.Now().Format("15:04:05"))
-	fmt.Printf("Final stats: %d total, %d success, %d errors, %d timeouts, %d filtered\n",
-		total, success, errors, timeouts, filtered)
-	fmt.Printf("Results saved in: %s\n", cfg.OutDir)
 }
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/davidwkirsch/api_spray/internal/config"
+	"github.com/davidwkirsch/api_spray/internal/output"
+)
+
+// runMerge combines the output directories of several scans into one
+func runMerge(args []string) {
+	cfg := config.ParseMergeFlags(args)
+
+	summary, err := output.Merge(cfg.OutDir, cfg.Inputs)
+	if err != nil {
+		log.Fatalf("Failed to merge scans: %v", err)
+	}
+
+	fmt.Printf("Merged %d scans into %s: %d results (%d duplicates dropped), %d stored responses, %d takeovers, %d bypasses\n",
+		len(cfg.Inputs), cfg.OutDir, summary.Results, summary.Duplicates, summary.Responses, summary.Takeovers, summary.Bypasses)
+}
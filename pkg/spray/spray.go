@@ -0,0 +1,192 @@
+// Package spray runs API Spray scans from Go programs. A Scanner is built
+// from Options holding the same configuration as the command line, and
+// delivers every saved result to a callback and any sinks while it writes
+// the usual output directory.
+package spray
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/davidwkirsch/api_spray/internal/config"
+	"github.com/davidwkirsch/api_spray/internal/http"
+	"github.com/davidwkirsch/api_spray/internal/logging"
+	"github.com/davidwkirsch/api_spray/internal/scanner"
+	"github.com/davidwkirsch/api_spray/internal/targets"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// Sink receives every result the scan saves
+type Sink = scanner.Sink
+
+// Matcher decides whether a response is a hit worth saving
+type Matcher = scanner.Matcher
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(result types.Result) error
+
+// WriteResult calls f(result)
+func (f SinkFunc) WriteResult(result types.Result) error {
+	return f(result)
+}
+
+// MatcherFunc adapts a function to a Matcher
+type MatcherFunc func(result types.Result) bool
+
+// Match calls f(result)
+func (f MatcherFunc) Match(result types.Result) bool {
+	return f(result)
+}
+
+// TokenRefresher fetches a new bearer token when requests start failing with
+// 401; an empty token means the refresh renewed session cookies instead
+type TokenRefresher = http.TokenRefresher
+
+// StopError is returned by Run when the scan stopped early because it used
+// up its -max-time or -max-requests budget, or finished with work skipped by
+// a per-host budget; progress is saved for resume
+type StopError = scanner.StopError
+
+// StatusCodes returns a matcher for responses with one of the status codes
+func StatusCodes(codes ...int) Matcher {
+	return scanner.StatusMatcher(codes)
+}
+
+// Options configures a Scanner
+type Options struct {
+	// Config holds the scan settings; start from DefaultConfig. The targets
+	// and wordlist file names in it are ignored.
+	Config *types.Config
+	// Targets in any form a targets file accepts: domains, URLs, host:port,
+	// CIDR blocks and IP ranges, httpx JSON lines
+	Targets []string
+	// Words to spray, or parameter names in params mode
+	Words []string
+	// Sinks receive every saved result, after it is written to Config.OutDir
+	Sinks []Sink
+	// Matchers decide which responses are saved; by default, responses with
+	// one of Config.StatusCodes. Titles and fingerprints are only read for
+	// responses with one of Config.StatusCodes.
+	Matchers []Matcher
+	// Logger receives progress, warnings and errors; nil discards them
+	Logger *slog.Logger
+	// DashboardOutput is where Config.Dashboard is drawn; os.Stdout by
+	// default. On a terminal, the status block is redrawn in place and only
+	// the built-in console logger writes above it.
+	DashboardOutput io.Writer
+	// TokenRefresher, if set, replaces the -auth-login-url and
+	// -auth-refresh-cmd refreshers. Like them, it needs Config.AuthCheckURL.
+	TokenRefresher TokenRefresher
+}
+
+// DefaultConfig returns a Config with the command line defaults
+func DefaultConfig() *types.Config {
+	return config.Defaults()
+}
+
+// Scanner runs a single scan
+type Scanner struct {
+	config  *types.Config
+	scan    *scanner.Scanner
+	targets *targets.List
+	words   []string
+}
+
+// New creates a scanner and its output directory. With Config.Resume, the
+// progress of an earlier scan in the same output directory is loaded.
+func New(opts Options) (*Scanner, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	if opts.TokenRefresher != nil && cfg.AuthCheckURL == "" {
+		return nil, fmt.Errorf("TokenRefresher needs Config.AuthCheckURL")
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = logging.Nop()
+	}
+
+	lines, err := targets.Parse(strings.NewReader(strings.Join(opts.Targets, "\n")), cfg.GetMode(), logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse targets: %w", err)
+	}
+	targetList, err := targets.NewList(lines)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse targets: %w", err)
+	}
+
+	scan, err := scanner.NewScanner(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	for _, sink := range opts.Sinks {
+		scan.AddSink(sink)
+	}
+	if len(opts.Matchers) > 0 {
+		scan.SetMatchers(opts.Matchers...)
+	}
+	if opts.DashboardOutput != nil {
+		scan.SetDashboardOutput(opts.DashboardOutput)
+	}
+	if opts.TokenRefresher != nil {
+		scan.SetTokenRefresher(opts.TokenRefresher)
+	}
+
+	if err := scan.Initialize(); err != nil {
+		scan.Close()
+		return nil, err
+	}
+
+	if cfg.Resume {
+		if err := scan.LoadProgress(); err != nil {
+			logger.Warn("Failed to load progress", "error", err)
+		}
+		if err := scan.LoadCompletedWork(); err != nil {
+			logger.Warn("Failed to load completed work", "error", err)
+		}
+	}
+
+	return &Scanner{
+		config:  cfg,
+		scan:    scan,
+		targets: targetList,
+		words:   opts.Words,
+	}, nil
+}
+
+// Targets returns the number of targets, with ranges counted per address
+func (s *Scanner) Targets() int {
+	return s.targets.Len()
+}
+
+// Run runs the scan, calling onResult for every saved result. onResult may be
+// nil and is called from the scan's workers, so it must be safe for
+// concurrent use. When ctx is cancelled, progress is saved so the scan can be
+// resumed, and ctx's error is returned. A scan that uses up its time or
+// request budget stops the same way and returns a *StopError, as does one
+// that finishes with work skipped by a per-host budget.
+func (s *Scanner) Run(ctx context.Context, onResult func(types.Result)) error {
+	if onResult != nil {
+		s.scan.AddSink(SinkFunc(func(result types.Result) error {
+			onResult(result)
+			return nil
+		}))
+	}
+	return s.scan.Run(ctx, s.targets, s.words)
+}
+
+// Stats returns a snapshot of the scan statistics
+func (s *Scanner) Stats() types.ScanStats {
+	return s.scan.StatsSnapshot()
+}
+
+// Close closes the output files
+func (s *Scanner) Close() error {
+	return s.scan.Close()
+}
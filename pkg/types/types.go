@@ -2,21 +2,115 @@ package types
 
 import "time"
 
-// Config holds all scanner configuration
+// Config holds all scanner configuration. It is saved as config.json in the
+// output directory so a scan can be resumed with the same settings.
 type Config struct {
-	TargetsFile  string
-	Wordlist     string
-	Mode         string
-	Threads      int
-	Batch        int
-	Timeout      time.Duration
-	OutDir       string
-	DisableHTTP  bool
-	Resume       bool
-	MaxRetries   int
-	UserAgent    string
-	FollowRedirs bool
-	StatusCodes  []int
+	TargetsFile  string        `json:"targets"`
+	Wordlist     string        `json:"wordlist"`
+	Mode         string        `json:"mode"`
+	Threads      int           `json:"threads"`
+	Batch        int           `json:"batch"`
+	Timeout      time.Duration `json:"timeout"`
+	OutDir       string        `json:"outdir"`
+	DisableHTTP  bool          `json:"disable_http"`
+	Resume       bool          `json:"-"`
+	MaxRetries   int           `json:"retries"`
+	UserAgent    string        `json:"user_agent"`
+	FollowRedirs bool          `json:"follow_redirects"`
+	StatusCodes  []int         `json:"status_codes"`
+	Takeover     bool          `json:"takeover"`
+	VHostDomain  string        `json:"domain,omitempty"`
+	ParamsChunk  int           `json:"params_chunk"`
+	ParamsIn     string        `json:"params_in"`
+	Proxy        string        `json:"proxy,omitempty"`
+	ReplayProxy  string        `json:"replay_proxy,omitempty"`
+
+	TLSVerify     bool   `json:"tls_verify"`
+	TLSCAFile     string `json:"tls_ca,omitempty"`
+	TLSClientCert string `json:"tls_cert,omitempty"`
+	TLSClientKey  string `json:"tls_key,omitempty"`
+	TLSServerName string `json:"sni,omitempty"`
+	TLSMinVersion string `json:"tls_min_version,omitempty"`
+
+	// Credentials are left out of config.json and passed again on resume
+	AuthBearer     string `json:"-"`
+	AuthBasic      string `json:"-"`
+	AuthLoginURL   string `json:"auth_login_url,omitempty"`
+	AuthLoginBody  string `json:"-"`
+	AuthTokenField string `json:"auth_token_field,omitempty"`
+	AuthRefreshCmd string `json:"-"`
+	AuthCheckURL   string `json:"auth_check_url,omitempty"`
+	CookieJar      bool   `json:"cookie_jar"`
+	AuthDiff       bool   `json:"auth_diff"`
+	AuthDiffBearer string `json:"-"`
+	AuthDiffBasic  string `json:"-"`
+	// OmittedAuth names the credential flags the scan was started with, so
+	// resume can insist they are passed again
+	OmittedAuth []string `json:"omitted_auth,omitempty"`
+
+	Bypass bool `json:"bypass"`
+
+	Delay    time.Duration `json:"delay,omitempty"`
+	Jitter   time.Duration `json:"jitter,omitempty"`
+	Schedule string        `json:"schedule,omitempty"`
+
+	MaxTime            time.Duration `json:"max_time,omitempty"`
+	MaxRequests        int64         `json:"max_requests,omitempty"`
+	MaxRequestsPerHost int64         `json:"max_requests_per_host,omitempty"`
+	MaxHostErrors      int64         `json:"max_host_errors,omitempty"`
+	DeadAfter          int           `json:"dead_after"`
+	DeadRecheck        time.Duration `json:"dead_recheck"`
+
+	Rotate         string        `json:"rotate,omitempty"`
+	UserAgentsFile string        `json:"user_agents,omitempty"`
+	HostJitter     time.Duration `json:"host_jitter,omitempty"`
+
+	HTTP2 bool  `json:"http2"`
+	H2C   bool  `json:"h2c"`
+	Ports []int `json:"ports,omitempty"`
+
+	ResolveIPs bool `json:"resolve_ips"`
+
+	StoreResponses bool   `json:"store_responses"`
+	JSONL          bool   `json:"jsonl"`
+	HTMLReport     string `json:"html_report,omitempty"`
+	Dashboard      bool   `json:"dashboard"`
+	MetricsAddr    string `json:"metrics_addr,omitempty"`
+
+	Verbose   bool   `json:"verbose"`
+	Quiet     bool   `json:"quiet"`
+	LogFormat string `json:"log_format"`
+}
+
+// ReportConfig holds configuration for the report command
+type ReportConfig struct {
+	OutDir     string
+	Format     string
+	Output     string
+	SizeBucket int64
+}
+
+// MergeConfig holds configuration for the merge command
+type MergeConfig struct {
+	OutDir string
+	Inputs []string
+}
+
+// DiffConfig holds configuration for the diff command
+type DiffConfig struct {
+	Old           string
+	New           string
+	Format        string
+	OutputFile    string
+	SizeThreshold int64
+	ExitCode      bool
+}
+
+// CalibrateConfig holds configuration for the calibrate command
+type CalibrateConfig struct {
+	Config
+	Format string
+	Probes int
 }
 
 // ScanMode represents different scanning modes
@@ -26,6 +120,8 @@ const (
 	ModeWildcards ScanMode = iota
 	ModeDirectories
 	ModeSubdomains
+	ModeVHosts
+	ModeParams
 )
 
 // GetMode returns the scan mode enum
@@ -35,6 +131,10 @@ func (c *Config) GetMode() ScanMode {
 		return ModeDirectories
 	case "subdomains":
 		return ModeSubdomains
+	case "vhosts":
+		return ModeVHosts
+	case "params":
+		return ModeParams
 	default:
 		return ModeWildcards
 	}
@@ -45,11 +145,95 @@ type Result struct {
 	Target        string `json:"target" csv:"target"`
 	Word          string `json:"word" csv:"word"`
 	URL           string `json:"url" csv:"url"`
+	Method        string `json:"method,omitempty" csv:"method"`
 	StatusCode    int    `json:"status_code" csv:"status_code"`
 	ContentLength int64  `json:"content_length" csv:"content_length"`
 	ResponseTime  int64  `json:"response_time_ms" csv:"response_time_ms"`
 	Title         string `json:"title,omitempty" csv:"title"`
 	Error         string `json:"error,omitempty" csv:"error"`
+	Host          string `json:"host,omitempty" csv:"host"`
+	TLSSubject    string `json:"tls_subject,omitempty" csv:"tls_subject"`
+	TLSIssuer     string `json:"tls_issuer,omitempty" csv:"tls_issuer"`
+	TLSSANs       string `json:"tls_sans,omitempty" csv:"tls_sans"`
+	TLSNotAfter   string `json:"tls_not_after,omitempty" csv:"tls_not_after"`
+	Protocol      string `json:"protocol,omitempty" csv:"protocol"`
+	Port          int    `json:"port,omitempty" csv:"port"`
+	Hostname      string `json:"hostname,omitempty" csv:"hostname"`
+	Fingerprint   string `json:"fingerprint,omitempty" csv:"fingerprint"`
+	ResponseFile  string `json:"response_file,omitempty" csv:"response_file"`
+
+	// AuthCompare is the same request sent without credentials, or with
+	// the second role's (-auth-diff)
+	AuthCompare *AuthComparison `json:"auth_compare,omitempty" csv:"-"`
+
+	// Raw response headers and body with -store-responses, only kept until
+	// the result is written
+	Response string `json:"-" csv:"-"`
+	// Whether Error is a timeout or connection error, rather than one from
+	// a host that answered
+	Unreachable bool `json:"-" csv:"-"`
+}
+
+// AuthComparison is the response to a request repeated with other credentials
+type AuthComparison struct {
+	StatusCode    int    `json:"status_code"`
+	ContentLength int64  `json:"content_length"`
+	Error         string `json:"error,omitempty"`
+	// Unprotected is set when the response matched the authenticated one:
+	// same status code and the same body or size
+	Unprotected bool `json:"unprotected"`
+}
+
+// ScanStats is a snapshot of the scan statistics, saved next to the results
+type ScanStats struct {
+	Mode             string           `json:"mode"`
+	StartTime        time.Time        `json:"start_time"`
+	EndTime          time.Time        `json:"end_time,omitempty"`
+	TotalRequests    int64            `json:"total_requests"`
+	SuccessCount     int64            `json:"success_count"`
+	ErrorCount       int64            `json:"error_count"`
+	TimeoutCount     int64            `json:"timeout_count"`
+	FilteredCount    int64            `json:"filtered_count"`
+	FilteredByTarget map[string]int64 `json:"filtered_by_target,omitempty"`
+	// Work items left undone because their host hit a budget, and why each
+	// host was skipped
+	SkippedCount int64             `json:"skipped_count,omitempty"`
+	SkippedHosts map[string]string `json:"skipped_hosts,omitempty"`
+	// Work items skipped while each target was dead
+	DeadTargets map[string]int64 `json:"dead_targets,omitempty"`
+	// Why the scan stopped before finishing, e.g. a -max-time budget
+	StopReason string `json:"stop_reason,omitempty"`
+}
+
+// TakeoverResult represents a potential subdomain takeover
+type TakeoverResult struct {
+	Target   string `json:"target" csv:"target"`
+	Host     string `json:"host" csv:"host"`
+	CNAME    string `json:"cname" csv:"cname"`
+	Service  string `json:"service" csv:"service"`
+	Evidence string `json:"evidence" csv:"evidence"`
+}
+
+// BypassCandidate is a 401 or 403 response queued for bypass probing
+type BypassCandidate struct {
+	Target        string `json:"target"`
+	Word          string `json:"word"`
+	URL           string `json:"url"`
+	Host          string `json:"host,omitempty"`
+	StatusCode    int    `json:"status_code"`
+	ContentLength int64  `json:"content_length"`
+}
+
+// BypassResult is a request variant that got a 2xx where the original request
+// got a 401 or 403
+type BypassResult struct {
+	BypassCandidate
+	Technique    string `json:"technique"`
+	Method       string `json:"method"`
+	BypassURL    string `json:"bypass_url"`
+	Header       string `json:"header,omitempty"`
+	BypassStatus int    `json:"bypass_status"`
+	BypassLength int64  `json:"bypass_length"`
 }
 
 // FalsePositiveTracker tracks response sizes that appear to be false positives
@@ -72,6 +256,16 @@ type Progress struct {
 	StartTime            time.Time             `json:"start_time"`
 	LastSaveTime         time.Time             `json:"last_save_time"`
 	FalsePositiveTracker *FalsePositiveTracker `json:"false_positive_tracker"`
+	// Map of target -> hostnames found in TLS certificates, tested after the main scan
+	SANCandidates map[string][]string `json:"san_candidates,omitempty"`
+	// Map of host[:port] -> scheme that worked for it, so requests skip the failed one
+	Schemes map[string]string `json:"schemes,omitempty"`
+	// 401 and 403 responses probed for bypasses after the main scan (-bypass)
+	BypassCandidates []BypassCandidate `json:"bypass_candidates,omitempty"`
+	// Why the last run stopped early; empty when it was interrupted
+	StopReason string `json:"stop_reason,omitempty"`
+	// Map of target -> first batch with work skipped for it, which resume redoes
+	Pending map[string]int `json:"pending,omitempty"`
 }
 
 // NewFalsePositiveTracker creates a new false positive tracker
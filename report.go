@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/davidwkirsch/api_spray/internal/config"
+	"github.com/davidwkirsch/api_spray/internal/report"
+)
+
+// runReport clusters the results of a finished scan and renders them
+func runReport(args []string) {
+	cfg := config.ParseReportFlags(args)
+
+	data, err := report.Load(cfg.OutDir, cfg.SizeBucket)
+	if err != nil {
+		log.Fatalf("Failed to load scan: %v", err)
+	}
+
+	out := os.Stdout
+	if cfg.Output != "" {
+		out, err = os.Create(cfg.Output)
+		if err != nil {
+			log.Fatalf("Failed to create report file: %v", err)
+		}
+		defer out.Close()
+	}
+
+	if err := report.Render(out, data, cfg.Format); err != nil {
+		log.Fatalf("Failed to render report: %v", err)
+	}
+}
+
+// writeHTMLReport renders the HTML report for the scan in outDir to path
+func writeHTMLReport(outDir, path string) error {
+	data, err := report.Load(outDir, 100)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return report.RenderHTML(file, data)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/davidwkirsch/api_spray/internal/config"
+	"github.com/davidwkirsch/api_spray/internal/logging"
+	"github.com/davidwkirsch/api_spray/internal/targets"
+	"github.com/davidwkirsch/api_spray/pkg/spray"
+	"github.com/davidwkirsch/api_spray/pkg/types"
+)
+
+// runScan runs a new or resumed scan
+func runScan(cfg *types.Config) {
+	logger, err := logging.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create logger: %v", err)
+	}
+
+	// Load input files; params mode can take the results of a previous scan as targets
+	var lines []string
+	if cfg.GetMode() == types.ModeParams && strings.HasSuffix(cfg.TargetsFile, ".csv") {
+		lines, err = config.LoadResultURLs(cfg.TargetsFile)
+	} else {
+		lines, err = targets.Load(cfg.TargetsFile, cfg.GetMode(), logger)
+	}
+	if err != nil {
+		fatal(logger, "Failed to load targets", err)
+	}
+
+	wordlist, err := config.LoadLines(cfg.Wordlist)
+	if err != nil {
+		fatal(logger, "Failed to load wordlist", err)
+	}
+
+	// Create scanner; CIDR blocks and IP ranges are expanded as the scan goes
+	scan, err := spray.New(spray.Options{
+		Config:  cfg,
+		Targets: lines,
+		Words:   wordlist,
+		Logger:  logger,
+	})
+	if err != nil {
+		fatal(logger, "Failed to create scanner", err)
+	}
+	defer scan.Close()
+
+	// Keep the options with the results so the scan can be resumed by its outdir
+	if err := config.Save(cfg); err != nil {
+		logger.Warn("Failed to save config", "error", err)
+	}
+
+	logger.Info("Starting scan",
+		"mode", cfg.Mode,
+		"targets", scan.Targets(),
+		"words", len(wordlist),
+		"threads", cfg.Threads,
+		"batch", cfg.Batch,
+		"timeout", cfg.Timeout.String(),
+		"status_codes", cfg.StatusCodes,
+		"http_fallback", !cfg.DisableHTTP,
+		"takeover", cfg.Takeover,
+	)
+
+	// Stop cleanly on Ctrl-C, keeping progress for -resume
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Run scan; a used up budget ends it cleanly with progress saved
+	err = scan.Run(ctx, nil)
+	var stopErr *spray.StopError
+	if err != nil && !errors.As(err, &stopErr) {
+		if ctx.Err() != nil {
+			logger.Warn("Resume with: api_spray resume "+cfg.OutDir, "outdir", cfg.OutDir)
+			scan.Close()
+			os.Exit(130)
+		}
+		fatal(logger, "Scan failed", err)
+	}
+
+	// Print final statistics
+	stats := scan.Stats()
+	attrs := []any{
+		"total", stats.TotalRequests,
+		"success", stats.SuccessCount,
+		"errors", stats.ErrorCount,
+		"timeouts", stats.TimeoutCount,
+		"filtered", stats.FilteredCount,
+		"skipped", stats.SkippedCount,
+		"outdir", cfg.OutDir,
+	}
+	if stopErr != nil {
+		attrs = append(attrs, "stop_reason", stopErr.Reason)
+	}
+	logger.Info("Final stats", attrs...)
+	if stopErr != nil {
+		logger.Warn("Resume with: api_spray resume "+cfg.OutDir, "outdir", cfg.OutDir)
+	}
+
+	if cfg.HTMLReport != "" {
+		if err := writeHTMLReport(cfg.OutDir, cfg.HTMLReport); err != nil {
+			logger.Warn("Failed to write HTML report", "error", err)
+		} else {
+			logger.Info("HTML report written", "file", cfg.HTMLReport)
+		}
+	}
+}
+
+// fatal logs an error that ends the scan and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}